@@ -23,7 +23,11 @@ import (
 	"io"
 	"math"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/willabides/yaml/internal/parserc"
 	"github.com/willabides/yaml/internal/resolve"
@@ -40,6 +44,16 @@ type parser struct {
 	anchors  map[string]*Node
 	doneInit bool
 	textless bool
+
+	maxMapEntries    int // The maximum number of entries in a single mapping, or 0.
+	maxDocMapEntries int // The maximum number of mapping entries in a document, or 0.
+	docMapEntries    int // The number of mapping entries in the current document.
+
+	trimTrailingSpace   bool // Trim trailing Unicode white space from plain scalars.
+	nonSpecificAsString bool // Resolve scalars with the "!" tag as strings.
+
+	depth   int // The nesting of the collection being parsed, 1 for the root.
+	endLine int // The last line of the last scalar, alias or flow collection.
 }
 
 func (p *parser) SetTextless(textless bool) {
@@ -56,6 +70,10 @@ func NewParser(b []byte) Parser {
 }
 
 func NewParserFromReader(r io.Reader) Parser {
+	return newParser(r)
+}
+
+func newParser(r io.Reader) *parser {
 	return &parser{
 		parser: *parserc.New(r),
 	}
@@ -154,6 +172,10 @@ func (p *parser) node(kind Kind, defaultTag, tag, value string) (*Node, error) {
 		style = TaggedStyle
 		tagIsSet = true
 	}
+	if tag == "!" && kind == ScalarNode && p.nonSpecificAsString {
+		tag = resolve.StrTag
+		tagIsSet = true
+	}
 	if !tagIsSet && defaultTag != "" {
 		tag = defaultTag
 		tagIsSet = true
@@ -196,6 +218,7 @@ func (p *parser) document() (*Node, error) {
 		return nil, err
 	}
 	p.doc = n
+	p.docMapEntries = 0
 	err = p.expect(yamlh.DOCUMENT_START_EVENT)
 	if err != nil {
 		return nil, err
@@ -227,6 +250,7 @@ func (p *parser) alias() (*Node, error) {
 	if n.Alias == nil {
 		return nil, fmt.Errorf("yaml: unknown anchor '%s' referenced", n.Value)
 	}
+	p.endLine = p.event.End_mark.Line + 1
 	err = p.expect(yamlh.ALIAS_EVENT)
 	if err != nil {
 		return nil, err
@@ -249,6 +273,9 @@ func (p *parser) scalar() (*Node, error) {
 	}
 	nodeValue := string(p.event.Value)
 	nodeTag := string(p.event.Tag)
+	if nodeStyle == 0 && p.trimTrailingSpace {
+		nodeValue = strings.TrimRightFunc(nodeValue, unicode.IsSpace)
+	}
 	var defaultTag string
 	if nodeStyle == 0 {
 		if nodeValue == "<<" {
@@ -263,6 +290,18 @@ func (p *parser) scalar() (*Node, error) {
 	}
 	n.Style |= nodeStyle
 	p.anchor(n, p.event.Anchor)
+	p.endLine = p.event.End_mark.Line + 1
+	switch {
+	case nodeStyle == LiteralStyle:
+		// Block scalars end at the next token, after the empty lines
+		// following them, so count the lines of a literal instead.
+		p.endLine = n.Line + strings.Count(nodeValue, "\n")
+		if nodeValue != "" && !strings.HasSuffix(nodeValue, "\n") {
+			p.endLine++
+		}
+	case p.event.End_mark.Column == 0:
+		p.endLine--
+	}
 	err = p.expect(yamlh.SCALAR_EVENT)
 	if err != nil {
 		return nil, err
@@ -283,6 +322,7 @@ func (p *parser) sequence() (*Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	p.depth++
 	for {
 		var nextEvent yamlh.EventType
 		nextEvent, err = p.peek()
@@ -299,6 +339,10 @@ func (p *parser) sequence() (*Node, error) {
 	}
 	n.LineComment = string(p.event.Line_comment)
 	n.FootComment = string(p.event.Foot_comment)
+	if n.Style&FlowStyle != 0 {
+		p.endLine = p.event.End_mark.Line + 1
+	}
+	p.depth--
 	err = p.expect(yamlh.SEQUENCE_END_EVENT)
 	if err != nil {
 		return nil, err
@@ -306,6 +350,178 @@ func (p *parser) sequence() (*Node, error) {
 	return n, nil
 }
 
+// sequenceItems parses the next document, which must hold a sequence, and
+// calls fn with each of its items as soon as it has been parsed, without
+// adding it to a sequence node.
+func (p *parser) sequenceItems(fn func(item *Node) error) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+	nextEvent, err := p.peek()
+	if err != nil {
+		return err
+	}
+	if nextEvent == yamlh.STREAM_END_EVENT {
+		return io.EOF
+	}
+	p.docMapEntries = 0
+	err = p.expect(yamlh.DOCUMENT_START_EVENT)
+	if err != nil {
+		return err
+	}
+	nextEvent, err = p.peek()
+	if err != nil {
+		return err
+	}
+	if nextEvent != yamlh.SEQUENCE_START_EVENT {
+		err = fmt.Errorf("yaml: line %d: document root is not a sequence", p.event.Start_mark.Line+1)
+		return p.skipDocument(err)
+	}
+	err = p.expect(yamlh.SEQUENCE_START_EVENT)
+	if err != nil {
+		return err
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	for {
+		nextEvent, err = p.peek()
+		if err != nil {
+			return err
+		}
+		if nextEvent == yamlh.SEQUENCE_END_EVENT {
+			break
+		}
+		item, err := p.Parse()
+		if err != nil {
+			return err
+		}
+		err = fn(item)
+		if err != nil {
+			return p.skipDocument(err)
+		}
+	}
+	err = p.expect(yamlh.SEQUENCE_END_EVENT)
+	if err != nil {
+		return err
+	}
+	return p.expect(yamlh.DOCUMENT_END_EVENT)
+}
+
+// mappingEntries parses the next document, which must hold a mapping, and
+// calls fn with each of its entries as soon as it has been parsed, without
+// adding it to a mapping node.
+func (p *parser) mappingEntries(fn func(key string, value *Node) error) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+	nextEvent, err := p.peek()
+	if err != nil {
+		return err
+	}
+	if nextEvent == yamlh.STREAM_END_EVENT {
+		return io.EOF
+	}
+	p.docMapEntries = 0
+	err = p.expect(yamlh.DOCUMENT_START_EVENT)
+	if err != nil {
+		return err
+	}
+	nextEvent, err = p.peek()
+	if err != nil {
+		return err
+	}
+	if nextEvent != yamlh.MAPPING_START_EVENT {
+		err = fmt.Errorf("yaml: line %d: document root is not a mapping", p.event.Start_mark.Line+1)
+		return p.skipDocument(err)
+	}
+	line := p.event.Start_mark.Line + 1
+	err = p.expect(yamlh.MAPPING_START_EVENT)
+	if err != nil {
+		return err
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	for entries := 1; ; entries++ {
+		nextEvent, err = p.peek()
+		if err != nil {
+			return err
+		}
+		if nextEvent == yamlh.MAPPING_END_EVENT {
+			break
+		}
+		err = p.countMapEntry(line, entries)
+		if err != nil {
+			return err
+		}
+		key, err := p.Parse()
+		if err != nil {
+			return err
+		}
+		resolved := key.Resolved()
+		if resolved == nil || resolved.Kind != ScalarNode {
+			err = fmt.Errorf("yaml: line %d: mapping key is not a scalar", key.Line)
+			return p.skipDocument(err)
+		}
+		value, err := p.Parse()
+		if err != nil {
+			return err
+		}
+		nextEvent, err = p.peek()
+		if err != nil {
+			return err
+		}
+		if nextEvent == yamlh.TAIL_COMMENT_EVENT {
+			err = p.expect(yamlh.TAIL_COMMENT_EVENT)
+			if err != nil {
+				return err
+			}
+		}
+		err = fn(resolved.Value, value)
+		if err != nil {
+			return p.skipDocument(err)
+		}
+	}
+	err = p.expect(yamlh.MAPPING_END_EVENT)
+	if err != nil {
+		return err
+	}
+	return p.expect(yamlh.DOCUMENT_END_EVENT)
+}
+
+// skipDocument discards the rest of the current document, so that the next
+// one can be read after err stopped reading this one, and returns err. A
+// syntax error found while skipping is returned instead.
+func (p *parser) skipDocument(err error) error {
+	for {
+		nextEvent, skipErr := p.peek()
+		if skipErr != nil {
+			return skipErr
+		}
+		if nextEvent == yamlh.STREAM_END_EVENT {
+			return err
+		}
+		p.event.Type = yamlh.NO_EVENT
+		if nextEvent == yamlh.DOCUMENT_END_EVENT {
+			return err
+		}
+	}
+}
+
+// countMapEntry checks the limits on mapping entries after a key has been
+// added to the mapping n.
+func (p *parser) countMapEntry(line, entries int) error {
+	p.docMapEntries++
+	if p.maxMapEntries > 0 && entries > p.maxMapEntries {
+		return fmt.Errorf("yaml: line %d: mapping exceeds the maximum of %d entries", line, p.maxMapEntries)
+	}
+	if p.maxDocMapEntries > 0 && p.docMapEntries > p.maxDocMapEntries {
+		return fmt.Errorf("yaml: document exceeds the maximum of %d mapping entries", p.maxDocMapEntries)
+	}
+	return nil
+}
+
 func (p *parser) mapping() (*Node, error) {
 	n, err := p.node(MappingNode, resolve.MapTag, string(p.event.Tag), "")
 	if err != nil {
@@ -321,6 +537,8 @@ func (p *parser) mapping() (*Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	p.depth++
+	blankLines := block && p.depth == 1 && !p.textless
 	for {
 		var nextEvent yamlh.EventType
 		nextEvent, err = p.peek()
@@ -331,11 +549,16 @@ func (p *parser) mapping() (*Node, error) {
 			break
 		}
 
+		end := p.endLine
 		var k *Node
 		k, err = p.parseChild(n)
 		if err != nil {
 			return nil, err
 		}
+		err = p.countMapEntry(n.Line, (len(n.Content)+1)/2)
+		if err != nil {
+			return nil, err
+		}
 		if block && k.FootComment != "" {
 			// Must be a foot comment for the prior value when being dedented.
 			if len(n.Content) > 2 {
@@ -343,6 +566,9 @@ func (p *parser) mapping() (*Node, error) {
 				k.FootComment = ""
 			}
 		}
+		if blankLines && len(n.Content) > 2 {
+			k.BlankLinesBefore = blankLinesBefore(k, end, n.Content[len(n.Content)-3], n.Content[len(n.Content)-2])
+		}
 		var v *Node
 		v, err = p.parseChild(n)
 		if err != nil {
@@ -372,6 +598,10 @@ func (p *parser) mapping() (*Node, error) {
 		n.Content[len(n.Content)-2].FootComment = n.FootComment
 		n.FootComment = ""
 	}
+	if !block {
+		p.endLine = p.event.End_mark.Line + 1
+	}
+	p.depth--
 	err = p.expect(yamlh.MAPPING_END_EVENT)
 	if err != nil {
 		return nil, err
@@ -379,6 +609,66 @@ func (p *parser) mapping() (*Node, error) {
 	return n, nil
 }
 
+// ambiguousType returns the type other than a string that n, a scalar
+// resolved to tag, may be meant as when it is a plain scalar ambiguous
+// between the two, as defined by Decoder.SetRequireExplicitAmbiguous, or ""
+// when it is not.
+func ambiguousType(n *Node, tag string) string {
+	if n.Style&(TaggedStyle|SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0 {
+		return ""
+	}
+	switch {
+	case tag == resolve.TimestampTag:
+		return "timestamp"
+	case tag == resolve.StrTag && isOldBool(n.Value):
+		return "bool"
+	}
+	return ""
+}
+
+// blankLinesBefore returns the number of empty lines between end, the last
+// line of prevValue, and key, whose entry follows the one of prevKey and
+// prevValue, or its head comment. The lines taken by the comments in
+// between are not counted, nor is the empty line after the head comment
+// that its trailing line break stands for.
+func blankLinesBefore(key *Node, end int, prevKey, prevValue *Node) int {
+	n := key.Line - commentLines(key.HeadComment) - end - 1
+	if strings.HasSuffix(key.HeadComment, "\n") {
+		n--
+	}
+	n -= trailingCommentLines(prevKey) + trailingCommentLines(prevValue)
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// trailingCommentLines returns the number of lines taken by the foot
+// comments of n and of its last descendants in block collections.
+func trailingCommentLines(n *Node) int {
+	lines := commentLines(n.FootComment)
+	if n.Style&FlowStyle != 0 {
+		return lines
+	}
+	switch {
+	case n.Kind == MappingNode && len(n.Content) >= 2:
+		lines += trailingCommentLines(n.Content[len(n.Content)-2]) + trailingCommentLines(n.Content[len(n.Content)-1])
+	case n.Kind == SequenceNode && len(n.Content) > 0:
+		lines += trailingCommentLines(n.Content[len(n.Content)-1])
+	}
+	return lines
+}
+
+// commentLines returns the number of lines taken by comment, leaving out
+// the empty line its trailing line break stands for, if any.
+func commentLines(comment string) int {
+	comment = strings.TrimRight(comment, "\n")
+	if comment == "" {
+		return 0
+	}
+	return strings.Count(comment, "\n") + 1
+}
+
 // ----------------------------------------------------------------------------
 // Decoder, unmarshals a node into a provided value.
 
@@ -392,16 +682,51 @@ type decoder struct {
 
 	knownFields bool
 	uniqueKeys  bool
+	octalMode   OctalMode
 	decodeCount int
 	aliasCount  int
 	aliasDepth  int
 
 	mergedFields map[interface{}]bool
+
+	keepTaggedAsNode   bool
+	precisionLossError bool
+	stringKeys         bool
+	complexKeyMode     ComplexKeyMode
+	exactFloatToInt    bool
+	nullMode           NullMode
+
+	// timestampType, when set, is the type timestamps are decoded as into
+	// interfaces. timestampField is the index of its embedded time.Time, or
+	// -1 when time.Time converts to it.
+	timestampType  reflect.Type
+	timestampField int
+
+	factories  map[reflect.Type]func(name string) (interface{}, error)
+	typeHints  map[string]reflect.Type
+	validators map[string]func(reflect.Value) error
+
+	useSQLScanner            bool
+	leadingZeroAsString      bool
+	caseInsensitiveFields    bool
+	requireExplicitAmbiguous bool
+	promoteEmbedded          bool
+	stringsAsRunes           bool
+
+	// interned, when set, holds the strings decoded so far so equal strings
+	// share their memory.
+	interned map[string]string
+
+	// present, when set, records the paths of the mapping keys decoded.
+	present *FieldSet
+	path    []string
 }
 
 var (
 	nodeType       = reflect.TypeOf(Node{})
+	nodePtrType    = reflect.PtrTo(nodeType)
 	durationType   = reflect.TypeOf(time.Duration(0))
+	timeType       = reflect.TypeOf(time.Time{})
 	stringMapType  = reflect.TypeOf(map[string]interface{}{})
 	generalMapType = reflect.TypeOf(map[interface{}]interface{}{})
 	ifaceType      = generalMapType.Elem()
@@ -560,17 +885,52 @@ func allowedAliasRatio(decodeCount int) float64 {
 	}
 }
 
-func (d *decoder) unmarshal(n *Node, out reflect.Value) (bool, error) {
+// countDecode accounts for a node being decoded and checks the ratio of
+// decoded aliases.
+func (d *decoder) countDecode() error {
 	d.decodeCount++
 	if d.aliasDepth > 0 {
 		d.aliasCount++
 	}
 	if d.aliasCount > 100 && d.decodeCount > 1000 && float64(d.aliasCount)/float64(d.decodeCount) > allowedAliasRatio(d.decodeCount) {
-		return false, fmt.Errorf("yaml: document contains excessive aliasing")
+		return fmt.Errorf("yaml: document contains excessive aliasing")
 	}
-	if out.Type() == nodeType {
+	return nil
+}
+
+func (d *decoder) unmarshal(n *Node, out reflect.Value) (bool, error) {
+	err := d.countDecode()
+	if err != nil {
+		return false, err
+	}
+	switch out.Type() {
+	case nodeType:
 		out.Set(reflect.ValueOf(n).Elem())
 		return true, nil
+	case nodePtrType:
+		if n.Kind == ScalarNode && n.ShortTag() == resolve.NullTag {
+			// As for any other pointer, null leaves it nil.
+			return d.null(out), nil
+		}
+		if out.IsNil() {
+			out.Set(reflect.New(nodeType))
+		}
+		out.Elem().Set(reflect.ValueOf(n).Elem())
+		return true, nil
+	}
+	if d.typeHints != nil && n.Style&TaggedStyle != 0 && out.Kind() == reflect.Interface {
+		if typ := d.typeHints[resolve.ShortTag(n.Tag)]; typ != nil && typ.AssignableTo(out.Type()) {
+			v := reflect.New(typ).Elem()
+			ok, err := d.unmarshal(n, v)
+			if ok {
+				out.Set(v)
+			}
+			return ok, err
+		}
+	}
+	if d.keepTaggedAsNode && out.Kind() == reflect.Interface && out.NumMethod() == 0 && hasCustomTag(n) {
+		out.Set(reflect.ValueOf(n))
+		return true, nil
 	}
 	switch n.Kind {
 	case DocumentNode:
@@ -585,6 +945,9 @@ func (d *decoder) unmarshal(n *Node, out reflect.Value) (bool, error) {
 	if unmarshaled {
 		return good, nil
 	}
+	if factory := d.factories[out.Type()]; factory != nil && n.Kind == ScalarNode && n.ShortTag() != resolve.NullTag {
+		return d.construct(n, out, factory)
+	}
 	switch n.Kind {
 	case ScalarNode:
 		return d.scalar(n, out)
@@ -600,6 +963,31 @@ func (d *decoder) unmarshal(n *Node, out reflect.Value) (bool, error) {
 	return false, fmt.Errorf("yaml: cannot decode node with unknown kind %d", n.Kind)
 }
 
+// construct sets out to the value returned by factory for the scalar n.
+func (d *decoder) construct(n *Node, out reflect.Value, factory func(name string) (interface{}, error)) (bool, error) {
+	v, err := factory(n.Value)
+	if err != nil {
+		return false, fmt.Errorf("yaml: line %d: %w", n.Line, err)
+	}
+	if v == nil {
+		out.Set(reflect.Zero(out.Type()))
+		return true, nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.Type().AssignableTo(out.Type()) {
+		return false, fmt.Errorf("yaml: line %d: factory for %s returned %T", n.Line, out.Type(), v)
+	}
+	out.Set(rv)
+	return true, nil
+}
+
+// hasCustomTag returns whether n is explicitly tagged with a tag outside of
+// the "!!" namespace, such as !custom.
+func hasCustomTag(n *Node) bool {
+	tag := resolve.ShortTag(n.Tag)
+	return n.Style&TaggedStyle != 0 && tag != "!" && !strings.HasPrefix(tag, "!!")
+}
+
 func (d *decoder) document(n *Node, out reflect.Value) (bool, error) {
 	if len(n.Content) == 1 {
 		d.doc = n
@@ -624,17 +1012,86 @@ func (d *decoder) alias(n *Node, out reflect.Value) (bool, error) {
 	return good, nil
 }
 
+// trimLeadingZeros returns s without the leading zeros of a YAML 1.1 style
+// octal such as 017, so that it resolves as a decimal integer.
+func trimLeadingZeros(s string) (string, bool) {
+	sign := ""
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	}
+	if len(s) < 2 || s[0] != '0' {
+		return "", false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && s[i] != '_' {
+			return "", false
+		}
+	}
+	s = strings.TrimLeft(s, "0_")
+	if s == "" {
+		s = "0"
+	}
+	return sign + s, true
+}
+
 func (d *decoder) null(out reflect.Value) bool {
 	if out.CanAddr() {
 		switch out.Kind() {
-		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
-			out.Set(reflect.Zero(out.Type()))
-			return true
+		case reflect.Map, reflect.Slice:
+			switch d.nullMode {
+			case NullKeepsValue:
+				return true
+			case NullMakesEmpty:
+				if out.Kind() == reflect.Map {
+					out.Set(reflect.MakeMap(out.Type()))
+				} else {
+					out.Set(reflect.MakeSlice(out.Type(), 0, 0))
+				}
+				return true
+			}
+		case reflect.Interface, reflect.Ptr:
+		default:
+			return false
 		}
+		out.Set(reflect.Zero(out.Type()))
+		return true
 	}
 	return false
 }
 
+// timestamp returns t as a value of timestampType.
+func (d *decoder) timestamp(t time.Time) reflect.Value {
+	if d.timestampField == -1 {
+		return reflect.ValueOf(t).Convert(d.timestampType)
+	}
+	v := reflect.New(d.timestampType).Elem()
+	v.Field(d.timestampField).Set(reflect.ValueOf(t))
+	return v
+}
+
+// isExactInt returns whether f is an integer in the range [min, max).
+func isExactInt(f, min, max float64) bool {
+	return f == math.Trunc(f) && f >= min && f < max
+}
+
+// intern returns the string decoded earlier that is equal to s, if any, when
+// string interning is enabled.
+func (d *decoder) intern(s string) string {
+	if d.interned == nil {
+		return s
+	}
+	if v, ok := d.interned[s]; ok {
+		return v
+	}
+	d.interned[s] = s
+	return s
+}
+
+// sqlScanner is implemented by the types implementing sql.Scanner.
+type sqlScanner interface {
+	Scan(src interface{}) error
+}
+
 //nolint:gocyclo // TODO: reduce cyclomatic complexity
 func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 	var tag string
@@ -648,6 +1105,23 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 		if err != nil {
 			return false, err
 		}
+		if d.leadingZeroAsString && n.Style&TaggedStyle == 0 && (tag == resolve.IntTag || tag == resolve.FloatTag) {
+			if _, ok := trimLeadingZeros(n.Value); ok {
+				tag, resolved = resolve.StrTag, n.Value
+			}
+		}
+		if d.octalMode == Strict12 && (tag == resolve.IntTag || tag == resolve.FloatTag) {
+			if decimal, ok := trimLeadingZeros(n.Value); ok {
+				rtag := n.Tag
+				if n.Style&TaggedStyle == 0 {
+					rtag = ""
+				}
+				tag, resolved, err = resolve.Resolve(rtag, decimal)
+				if err != nil {
+					return false, err
+				}
+			}
+		}
 		if tag == resolve.BinaryTag {
 			var data []byte
 			data, err = base64.StdEncoding.DecodeString(resolved.(string))
@@ -660,11 +1134,28 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 	if resolved == nil {
 		return d.null(out), nil
 	}
+	if s, ok := resolved.(string); ok {
+		resolved = d.intern(s)
+	}
 	if resolvedv := reflect.ValueOf(resolved); out.Type() == resolvedv.Type() {
 		// We've resolved to exactly the type we want, so use that.
 		out.Set(resolvedv)
 		return true, nil
 	}
+	if d.useSQLScanner && out.CanAddr() {
+		if s, ok := out.Addr().Interface().(sqlScanner); ok {
+			src := resolved
+			switch v := resolved.(type) {
+			case int:
+				src = int64(v)
+			case string:
+				if tag == resolve.BinaryTag {
+					src = []byte(v)
+				}
+			}
+			return true, s.Scan(src)
+		}
+	}
 	// Perhaps we can use the value as a TextUnmarshaler to
 	// set its value.
 	if out.CanAddr() {
@@ -688,13 +1179,29 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 	}
 	switch out.Kind() {
 	case reflect.String:
+		value := n.Value
 		if tag == resolve.BinaryTag {
-			out.SetString(resolved.(string))
-			return true, nil
+			value = resolved.(string)
+		}
+		if info := getEnumInfo(out.Type()); info != nil && !info.valid[value] {
+			d.typeErrors = append(d.typeErrors, fmt.Sprintf("line %d: invalid value %q for %s: must be one of %s",
+				n.Line, value, out.Type(), strings.Join(info.names, ", ")))
+			return false, nil
 		}
-		out.SetString(n.Value)
+		out.SetString(d.intern(value))
 		return true, nil
 	case reflect.Interface:
+		if d.requireExplicitAmbiguous {
+			if other := ambiguousType(n, tag); other != "" {
+				d.typeErrors = append(d.typeErrors, fmt.Sprintf("line %d: ambiguous plain scalar `%s` may be a %s or a string: add an explicit tag or quotes",
+					n.Line, n.Value, other))
+				return false, nil
+			}
+		}
+		if t, ok := resolved.(time.Time); ok && d.timestampType != nil && d.timestampType.AssignableTo(out.Type()) {
+			out.Set(d.timestamp(t))
+			return true, nil
+		}
 		out.Set(reflect.ValueOf(resolved))
 		return true, nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -718,6 +1225,9 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 				return true, nil
 			}
 		case float64:
+			if d.exactFloatToInt && !isExactInt(resolved, -1<<63, 1<<63) {
+				break
+			}
 			if !isDuration && resolved <= math.MaxInt64 && !out.OverflowInt(int64(resolved)) {
 				out.SetInt(int64(resolved))
 				return true, nil
@@ -730,6 +1240,14 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 					return true, nil
 				}
 			}
+			// A string made of a single character decodes into a rune.
+			if d.stringsAsRunes && out.Kind() == reflect.Int32 && tag == resolve.StrTag {
+				if utf8.ValidString(resolved) && utf8.RuneCountInString(resolved) == 1 {
+					r, _ := utf8.DecodeRuneInString(resolved)
+					out.SetInt(int64(r))
+					return true, nil
+				}
+			}
 		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		switch resolved := resolved.(type) {
@@ -749,6 +1267,9 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 				return true, nil
 			}
 		case float64:
+			if d.exactFloatToInt && !isExactInt(resolved, 0, 1<<64) {
+				break
+			}
 			if resolved <= math.MaxUint64 && !out.OverflowUint(uint64(resolved)) {
 				out.SetUint(uint64(resolved))
 				return true, nil
@@ -772,25 +1293,34 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 			}
 		}
 	case reflect.Float32, reflect.Float64:
-		switch resolved := resolved.(type) {
-		case int:
-			out.SetFloat(float64(resolved))
-			return true, nil
-		case int64:
-			out.SetFloat(float64(resolved))
-			return true, nil
-		case uint64:
-			out.SetFloat(float64(resolved))
-			return true, nil
-		case float64:
-			out.SetFloat(resolved)
-			return true, nil
+		f, exact, ok := toFloat(resolved)
+		if !ok {
+			break
 		}
+		if out.Kind() == reflect.Float32 && !math.IsNaN(f) && float64(float32(f)) != f {
+			exact = false
+		}
+		if !exact && d.precisionLossError {
+			break
+		}
+		out.SetFloat(f)
+		return true, nil
 	case reflect.Struct:
 		if resolvedv := reflect.ValueOf(resolved); out.Type() == resolvedv.Type() {
 			out.Set(resolvedv)
 			return true, nil
 		}
+	case reflect.Slice:
+		// A string decodes into a []rune as its characters.
+		if s, ok := resolved.(string); ok && d.stringsAsRunes && tag == resolve.StrTag && out.Type().Elem().Kind() == reflect.Int32 {
+			runes := []rune(s)
+			sv := reflect.MakeSlice(out.Type(), len(runes), len(runes))
+			for i, r := range runes {
+				sv.Index(i).SetInt(int64(r))
+			}
+			out.Set(sv)
+			return true, nil
+		}
 	case reflect.Ptr:
 		panic("yaml internal error: please report the issue")
 	}
@@ -798,6 +1328,25 @@ func (d *decoder) scalar(n *Node, out reflect.Value) (bool, error) {
 	return false, nil
 }
 
+// toFloat converts a resolved int or float to a float64, reporting whether
+// the conversion is exact.
+func toFloat(v interface{}) (f float64, exact, ok bool) {
+	switch v := v.(type) {
+	case int:
+		f = float64(v)
+		return f, f < 1<<63 && int64(f) == int64(v), true
+	case int64:
+		f = float64(v)
+		return f, f < 1<<63 && int64(f) == v, true
+	case uint64:
+		f = float64(v)
+		return f, f < 1<<64 && uint64(f) == v, true
+	case float64:
+		return v, true, true
+	}
+	return 0, false, false
+}
+
 func settableValueOf(i interface{}) reflect.Value {
 	v := reflect.ValueOf(i)
 	sv := reflect.New(v.Type()).Elem()
@@ -830,7 +1379,13 @@ func (d *decoder) sequence(n *Node, out reflect.Value) (bool, error) {
 	for i := 0; i < l; i++ {
 		e := reflect.New(et).Elem()
 
+		if d.present != nil {
+			d.path = append(d.path, strconv.Itoa(i))
+		}
 		ok, err := d.unmarshal(n.Content[i], e)
+		if d.present != nil {
+			d.path = d.path[:len(d.path)-1]
+		}
 		if err != nil {
 			return false, err
 		}
@@ -848,16 +1403,86 @@ func (d *decoder) sequence(n *Node, out reflect.Value) (bool, error) {
 	return true, nil
 }
 
+// pairFields returns the indexes of the key and value fields of t when it is
+// a struct made of exactly those two fields, such as
+// struct{ Key string; Value int }. Fields are matched by their yaml key, so
+// other names may be used with `yaml:"key"` and `yaml:"value"` tags.
+func pairFields(t reflect.Type) (key, value int, ok bool) {
+	if t.Kind() != reflect.Struct {
+		return 0, 0, false
+	}
+	sinfo, err := getStructInfo(t)
+	if err != nil || len(sinfo.FieldsList) != 2 || sinfo.InlineMap != -1 {
+		return 0, 0, false
+	}
+	k, kok := sinfo.FieldsMap["key"]
+	v, vok := sinfo.FieldsMap["value"]
+	if !kok || !vok || k.Inline != nil || v.Inline != nil {
+		return 0, 0, false
+	}
+	return k.Num, v.Num, true
+}
+
+// mappingPairs decodes the mapping n into out, a slice of key/value structs,
+// keeping the document order. Merge keys are not expanded.
+func (d *decoder) mappingPairs(n *Node, out reflect.Value, key, value int) (bool, error) {
+	pairs := reflect.MakeSlice(out.Type(), 0, len(n.Content)/2)
+	et := out.Type().Elem()
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		e := reflect.New(et).Elem()
+		ok, err := d.unmarshal(n.Content[i], e.Field(key))
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+		d.enterKey(fmt.Sprint(e.Field(key).Interface()))
+		_, err = d.unmarshal(n.Content[i+1], e.Field(value))
+		d.leaveKey()
+		if err != nil {
+			return false, err
+		}
+		pairs = reflect.Append(pairs, e)
+	}
+	out.Set(pairs)
+	return true, nil
+}
+
+// isRepeatedKey reports whether key is the key of a ,repeated field of the
+// struct out, which may occur several times in a mapping.
+func isRepeatedKey(out reflect.Value, key *Node) bool {
+	if out.Kind() != reflect.Struct || key.Kind != ScalarNode {
+		return false
+	}
+	sinfo, err := getStructInfo(out.Type())
+	if err != nil {
+		panic(err)
+	}
+	return sinfo.FieldsMap[key.Value].Repeated
+}
+
 //nolint:gocyclo // TODO: reduce cyclomatic complexity
 func (d *decoder) mapping(n *Node, out reflect.Value) (bool, error) {
 	l := len(n.Content)
 	if d.uniqueKeys {
+		keys := n.Content
+		if d.complexKeyMode == ComplexKeyStringify {
+			keys = make([]*Node, l)
+			for i := 0; i < l; i += 2 {
+				key, err := d.keyNode(n.Content[i])
+				if err != nil {
+					return false, err
+				}
+				keys[i] = key
+			}
+		}
 		newErr := false
 		for i := 0; i < l; i += 2 {
-			ni := n.Content[i]
+			ni := keys[i]
 			for j := i + 2; j < l; j += 2 {
-				nj := n.Content[j]
-				if ni.Kind == nj.Kind && ni.Value == nj.Value {
+				nj := keys[j]
+				if ni.Kind == nj.Kind && ni.Value == nj.Value && !isRepeatedKey(out, ni) {
 					d.typeErrors = append(d.typeErrors, fmt.Sprintf("line %d: mapping key %#v already defined at line %d", nj.Line, nj.Value, ni.Line))
 					newErr = true
 				}
@@ -870,11 +1495,17 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (bool, error) {
 	switch out.Kind() {
 	case reflect.Struct:
 		return d.mappingStruct(n, out)
+	case reflect.Slice:
+		if key, value, ok := pairFields(out.Type().Elem()); ok {
+			return d.mappingPairs(n, out, key, value)
+		}
+		d.terror(n, resolve.MapTag, out)
+		return false, nil
 	case reflect.Map:
 		// okay
 	case reflect.Interface:
 		iface := out
-		if isStringMap(n) {
+		if d.isStringMap(n) {
 			out = reflect.MakeMap(d.stringMapType)
 		} else {
 			out = reflect.MakeMap(d.generalMapType)
@@ -909,13 +1540,51 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (bool, error) {
 		out.Set(reflect.MakeMap(outt))
 		mapIsNew = true
 	}
+
+	// Entries where both the key and the value are strings are set directly
+	// in maps of these exact types, avoiding reflection.
+	var strMap map[string]string
+	var ifaceMap map[string]interface{}
+	if mergedFields == nil && d.present == nil && out.CanInterface() {
+		switch m := out.Interface().(type) {
+		case map[string]string:
+			strMap = m
+		case map[string]interface{}:
+			if !d.requireExplicitAmbiguous {
+				ifaceMap = m
+			}
+		}
+	}
+
 	for i := 0; i < l; i += 2 {
-		if isMerge(n.Content[i]) {
+		kn, err := d.keyNode(n.Content[i])
+		if err != nil {
+			return false, err
+		}
+		if strMap != nil || ifaceMap != nil {
+			vn := n.Content[i+1]
+			if kn.indicatedString() && vn.indicatedString() {
+				err := d.countDecode()
+				if err == nil {
+					err = d.countDecode()
+				}
+				if err != nil {
+					return false, err
+				}
+				if strMap != nil {
+					strMap[d.intern(kn.Value)] = d.intern(vn.Value)
+				} else {
+					ifaceMap[d.intern(kn.Value)] = d.intern(vn.Value)
+				}
+				continue
+			}
+		}
+		if isMerge(kn) {
 			mergeNode = n.Content[i+1]
 			continue
 		}
 		k := reflect.New(kt).Elem()
-		ok, err := d.unmarshal(n.Content[i], k)
+		ok, err := d.unmarshal(kn, k)
 		if err != nil {
 			return false, err
 		}
@@ -937,7 +1606,9 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (bool, error) {
 				return false, fmt.Errorf("yaml: invalid map key: %#v", k.Interface())
 			}
 			e := reflect.New(et).Elem()
+			d.enterKey(fmt.Sprint(k.Interface()))
 			ok, err = d.unmarshal(n.Content[i+1], e)
+			d.leaveKey()
 			if err != nil {
 				return false, err
 			}
@@ -960,13 +1631,78 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (bool, error) {
 	return true, nil
 }
 
-func isStringMap(n *Node) bool {
+// keyNode returns the node to decode as the mapping key n. When stringKeys
+// is set, untagged scalar keys other than merge keys are decoded as strings.
+// With ComplexKeyStringify, sequence and mapping keys are decoded as their
+// flow style YAML.
+func (d *decoder) keyNode(n *Node) (*Node, error) {
+	if d.complexKeyMode == ComplexKeyStringify {
+		content := n
+		if content.Kind == AliasNode {
+			content = content.Alias
+		}
+		if content.Kind == SequenceNode || content.Kind == MappingNode {
+			flow, err := flowNode(content, map[*Node]bool{})
+			if err != nil {
+				return nil, err
+			}
+			out, err := Marshal(flow)
+			if err != nil {
+				return nil, err
+			}
+			return &Node{
+				Kind:   ScalarNode,
+				Tag:    resolve.StrTag,
+				Value:  strings.TrimSuffix(string(out), "\n"),
+				Line:   n.Line,
+				Column: n.Column,
+			}, nil
+		}
+	}
+	if !d.stringKeys || n.Kind != ScalarNode || n.Style&TaggedStyle != 0 || isMerge(n) {
+		return n, nil
+	}
+	key := *n
+	key.Tag = resolve.StrTag
+	return &key, nil
+}
+
+// flowNode returns a copy of n in flow style, without anchors or comments
+// and with aliases replaced by the nodes they refer to.
+func flowNode(n *Node, seen map[*Node]bool) (*Node, error) {
+	if n.Kind == AliasNode {
+		if seen[n.Alias] {
+			return nil, fmt.Errorf("yaml: anchor '%s' value contains itself", n.Value)
+		}
+		n = n.Alias
+	}
+	seen[n] = true
+	defer delete(seen, n)
+	flow := &Node{Kind: n.Kind, Tag: n.Tag, Value: n.Value, Style: n.Style}
+	if n.Kind != ScalarNode {
+		flow.Style |= FlowStyle
+	}
+	for _, c := range n.Content {
+		fc, err := flowNode(c, seen)
+		if err != nil {
+			return nil, err
+		}
+		flow.Content = append(flow.Content, fc)
+	}
+	return flow, nil
+}
+
+func (d *decoder) isStringMap(n *Node) bool {
 	if n.Kind != MappingNode {
 		return false
 	}
 	l := len(n.Content)
 	for i := 0; i < l; i += 2 {
-		short := n.Content[i].ShortTag()
+		key, err := d.keyNode(n.Content[i])
+		if err != nil {
+			return false
+		}
+		short := key.ShortTag()
 		if short != resolve.StrTag && short != resolve.MergeTag {
 			return false
 		}
@@ -980,10 +1716,35 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (bool, error) {
 		panic(err)
 	}
 
-	var inlineMap reflect.Value
+	var promoted map[string]fieldInfo
+	if d.promoteEmbedded {
+		promoted, err = getPromotedFields(out.Type(), sinfo)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if sinfo.TagField != -1 {
+		out.Field(sinfo.TagField).SetString(n.ShortTag())
+	}
+
+	var inlineMap, inlineIface reflect.Value
 	var elemType reflect.Type
 	if sinfo.InlineMap != -1 {
 		inlineMap = out.Field(sinfo.InlineMap)
+		if inlineMap.Kind() == reflect.Interface {
+			// The keys go into a map[string]interface{}, which is only
+			// stored in the field if there are any.
+			inlineIface = inlineMap
+			inlineMap = reflect.New(stringMapType).Elem()
+			if m, ok := inlineIface.Interface().(map[string]interface{}); ok {
+				inlineMap.Set(reflect.ValueOf(m))
+			}
+		}
+		if inlineMap.Kind() == reflect.Slice && d.mergedFields == nil {
+			// An InlineMap is replaced, unless merging keys into it.
+			inlineMap.Set(reflect.Zero(inlineMap.Type()))
+		}
 		elemType = inlineMap.Type().Elem()
 	}
 
@@ -998,9 +1759,10 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (bool, error) {
 	mergedFields := d.mergedFields
 	d.mergedFields = nil
 	var mergeNode *Node
-	var doneFields []bool
+	var doneFields, repeated []bool
+	var lastField string
 	if d.uniqueKeys {
-		doneFields = make([]bool, len(sinfo.FieldsList))
+		doneFields = make([]bool, len(sinfo.FieldsList)+len(promoted))
 	}
 	name := settableValueOf("")
 	l := len(n.Content)
@@ -1019,14 +1781,27 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (bool, error) {
 			continue
 		}
 		sname := name.String()
+		if _, ok := sinfo.FieldsMap[sname]; !ok && d.caseInsensitiveFields {
+			if key, ok := sinfo.foldedKey(sname); ok {
+				sname = key
+			}
+		}
 		if mergedFields != nil {
 			if mergedFields[sname] {
 				continue
 			}
 			mergedFields[sname] = true
 		}
-		if info, ok := sinfo.FieldsMap[sname]; ok {
-			if d.uniqueKeys {
+		if index, ok := sinfo.LineFields[sname]; ok {
+			d.fieldByIndex(n, out, index).SetInt(int64(n.Content[i+1].Line))
+		}
+		info, ok := sinfo.FieldsMap[sname]
+		if !ok {
+			info, ok = promoted[sname]
+		}
+		if ok {
+			lastField = sname
+			if d.uniqueKeys && !info.Repeated {
 				if doneFields[info.Id] {
 					d.typeErrors = append(d.typeErrors, fmt.Sprintf("line %d: field %s already set in type %s", ni.Line, name.String(), out.Type()))
 					continue
@@ -1039,16 +1814,56 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (bool, error) {
 			} else {
 				field = d.fieldByIndex(n, out, info.Inline)
 			}
-			_, err = d.unmarshal(n.Content[i+1], field)
+			if info.Repeated {
+				// The first occurrence replaces the slice, and the
+				// others are appended to it.
+				if repeated == nil {
+					repeated = make([]bool, len(sinfo.FieldsList)+len(promoted))
+				}
+				if !repeated[info.Id] {
+					field.Set(reflect.MakeSlice(field.Type(), 0, 1))
+					repeated[info.Id] = true
+				}
+				elem := reflect.New(field.Type().Elem()).Elem()
+				d.enterKey(sname)
+				ok, err = d.unmarshal(n.Content[i+1], elem)
+				d.leaveKey()
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					d.validate(n.Content[i+1], info, out.Type(), elem)
+					field.Set(reflect.Append(field, elem))
+				}
+				continue
+			}
+			d.enterKey(sname)
+			ok, err = d.unmarshal(n.Content[i+1], field)
+			d.leaveKey()
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				d.validate(n.Content[i+1], info, out.Type(), field)
+			}
+		} else if sinfo.InlineMap != -1 && inlineMap.Kind() == reflect.Slice {
+			var value interface{}
+			d.enterKey(sname)
+			_, err = d.unmarshal(n.Content[i+1], reflect.ValueOf(&value).Elem())
+			d.leaveKey()
 			if err != nil {
 				return false, err
 			}
+			item := InlineItem{Key: name.String(), Value: value, after: lastField, placed: mergedFields == nil}
+			inlineMap.Set(reflect.Append(inlineMap, reflect.ValueOf(item)))
 		} else if sinfo.InlineMap != -1 {
 			if inlineMap.IsNil() {
 				inlineMap.Set(reflect.MakeMap(inlineMap.Type()))
 			}
 			value := reflect.New(elemType).Elem()
+			d.enterKey(sname)
 			_, err = d.unmarshal(n.Content[i+1], value)
+			d.leaveKey()
 			if err != nil {
 				return false, err
 			}
@@ -1058,6 +1873,9 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (bool, error) {
 		}
 	}
 
+	if inlineIface.IsValid() && !inlineMap.IsNil() {
+		inlineIface.Set(inlineMap)
+	}
 	d.mergedFields = mergedFields
 	if mergeNode != nil {
 		err = d.merge(n, mergeNode, out)
@@ -1068,6 +1886,39 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (bool, error) {
 	return true, nil
 }
 
+// validate calls the validator of the field described by info, if any, with
+// value, decoded from n, recording the error it returns as a type error.
+func (d *decoder) validate(n *Node, info fieldInfo, st reflect.Type, value reflect.Value) {
+	if info.Validator == "" {
+		return
+	}
+	fn := d.validators[info.Validator]
+	if fn == nil {
+		d.typeErrors = append(d.typeErrors, fmt.Sprintf("line %d: unknown validator %q for field %s in type %s", n.Line, info.Validator, info.Key, st))
+		return
+	}
+	if err := fn(value); err != nil {
+		d.typeErrors = append(d.typeErrors, fmt.Sprintf("line %d: invalid value for field %s in type %s: %v", n.Line, info.Key, st, err))
+	}
+}
+
+// enterKey records key as present when tracking presence, and makes it the
+// innermost element of the current path until the matching leaveKey.
+func (d *decoder) enterKey(key string) {
+	if d.present == nil {
+		return
+	}
+	d.path = append(d.path, key)
+	d.present.add(d.path)
+}
+
+func (d *decoder) leaveKey() {
+	if d.present == nil {
+		return
+	}
+	d.path = d.path[:len(d.path)-1]
+}
+
 func (d *decoder) merge(parent, merge *Node, out reflect.Value) error {
 	mergedFields := d.mergedFields
 	if mergedFields == nil {
@@ -1123,6 +1974,73 @@ func (d *decoder) merge(parent, merge *Node, out reflect.Value) error {
 	return nil
 }
 
+// typedMap decodes the entries of mapping n into out for
+// Decoder.DecodeTypedMap, skipping the keys in set, which were set from
+// entries that take precedence, and adding the keys it sets. As when
+// decoding a map, the keys of a mapping take precedence over the mappings
+// it merges, and earlier merged mappings over later ones.
+func (d *decoder) typedMap(n *Node, typeForKey func(key string) reflect.Type, out map[string]interface{}, set map[string]bool) error {
+	var merges []*Node
+	own := make(map[string]bool, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if isMerge(n.Content[i]) {
+			merges = append(merges, n.Content[i+1])
+			continue
+		}
+		var key string
+		ok, err := d.unmarshal(n.Content[i], reflect.ValueOf(&key).Elem())
+		if err != nil {
+			return err
+		}
+		if !ok || set[key] && !own[key] {
+			continue
+		}
+		typ := typeForKey(key)
+		if typ == nil {
+			typ = ifaceType
+		}
+		value := reflect.New(typ).Elem()
+		if _, err := d.unmarshal(n.Content[i+1], value); err != nil {
+			return err
+		}
+		out[key] = value.Interface()
+		own[key] = true
+	}
+	for key := range own {
+		set[key] = true
+	}
+
+	wantMapErr := fmt.Errorf("yaml: map merge requires map or sequence of maps as the value")
+	for _, merge := range merges {
+		sources := []*Node{merge}
+		if merge.Kind == SequenceNode {
+			sources = merge.Content
+		}
+		for _, src := range sources {
+			alias := src
+			if src.Kind == AliasNode {
+				if d.aliases[src] {
+					return fmt.Errorf("yaml: anchor '%s' value contains itself", src.Value)
+				}
+				if src.Alias == nil {
+					return fmt.Errorf("yaml: unknown anchor '%s' referenced", src.Value)
+				}
+				src = src.Alias
+			}
+			if src.Kind != MappingNode {
+				return wantMapErr
+			}
+			d.aliases[alias] = true
+			err := d.typedMap(src, typeForKey, out, set)
+			delete(d.aliases, alias)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func isMerge(n *Node) bool {
 	return n.Kind == ScalarNode && n.Value == "<<" && (n.Tag == "" || n.Tag == "!" || resolve.ShortTag(n.Tag) == resolve.MergeTag)
 }
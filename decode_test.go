@@ -17,15 +17,20 @@ package yaml_test
 
 import (
 	"bytes"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
+	"unsafe"
 
 	"github.com/stretchr/testify/require"
 	"github.com/willabides/yaml"
@@ -672,6 +677,44 @@ var unmarshalTests = []struct {
 		}{A: 1, C: &inlineD{C: &inlineC{C: 3}, D: 4}},
 	},
 
+	// Embedded struct pointers are decoded from their own key.
+	{
+		data: "a: 1\nembeddedb: {b: 2}\n",
+		value: &struct {
+			*EmbeddedB
+			A int
+		}{EmbeddedB: &EmbeddedB{B: 2}, A: 1},
+	},
+	{
+		data: "a: 1\nembeddedb: {b: 2}\n",
+		value: &struct {
+			*EmbeddedB `yaml:"embeddedb"`
+			A          int
+		}{EmbeddedB: &EmbeddedB{B: 2}, A: 1},
+	},
+
+	// Mappings into slices of key/value pairs.
+	{
+		data: "b: 2\na: 1\n",
+		value: &[]struct {
+			Key   string
+			Value int
+		}{{Key: "b", Value: 2}, {Key: "a", Value: 1}},
+	},
+	{
+		data: "x:\n  k: [1, 2]\n  2: []\n",
+		value: &struct {
+			X []keyItems
+		}{X: []keyItems{{Name: "k", Items: []int{1, 2}}, {Name: 2, Items: []int{}}}},
+	},
+	{
+		data: "{}",
+		value: &[]struct {
+			Key   string
+			Value int
+		}{},
+	},
+
 	// Map inlining
 	{
 		data: "a: 1\nb: 2\nc: 3\n",
@@ -787,18 +830,28 @@ var unmarshalTests = []struct {
 		data:  "a: 2015-02-24 18:19:39\n",
 		value: map[string]time.Time{"a": time.Date(2015, 2, 24, 18, 19, 39, 0, time.UTC)},
 	},
-	// Some cases not currently handled. Uncomment these when
-	// the code is fixed.
-	//	{
-	//		// space separated with time zone
-	//		"a: 2001-12-14 21:59:43.10 -5",
-	//		map[string]interface{}{"a": time.Date(2001, 12, 14, 21, 59, 43, .1e9, time.UTC)},
-	//	},
-	//	{
-	//		// arbitrary whitespace between fields
-	//		"a: 2001-12-14 \t\t \t21:59:43.10 \t Z",
-	//		map[string]interface{}{"a": time.Date(2001, 12, 14, 21, 59, 43, .1e9, time.UTC)},
-	//	},
+	{
+		// space separated with time zone, which is kept rather than
+		// converted to UTC: this is 2001-12-15 02:59:43.10 UTC
+		data:  "a: 2001-12-14 21:59:43.10 -5",
+		value: map[string]interface{}{"a": time.Date(2001, 12, 14, 21, 59, 43, .1e9, time.FixedZone("", -5*60*60))},
+	},
+	{
+		// space separated with time zone including minutes: this is
+		// 2001-12-14 16:29:43.10 UTC
+		data:  "a: 2001-12-14 21:59:43.10 +05:30",
+		value: map[string]time.Time{"a": time.Date(2001, 12, 14, 21, 59, 43, .1e9, time.FixedZone("", 5*60*60+30*60))},
+	},
+	{
+		// arbitrary whitespace between fields
+		data:  "a: 2001-12-14 \t\t \t21:59:43.10 \t Z",
+		value: map[string]interface{}{"a": time.Date(2001, 12, 14, 21, 59, 43, .1e9, time.UTC)},
+	},
+	{
+		// out of range fields are not a timestamp
+		data:  "a: 2001-12-14 25:59:43",
+		value: map[string]interface{}{"a": "2001-12-14 25:59:43"},
+	},
 	{
 		// explicit string tag
 		data:  "a: !!str 2015-01-01",
@@ -914,6 +967,31 @@ type inlineC struct {
 	C int
 }
 
+type keyItems struct {
+	Name  interface{} `yaml:"key"`
+	Items []int       `yaml:"value"`
+}
+
+type EmbeddedB struct {
+	B int
+	C int
+}
+
+type EmbeddedC struct {
+	C int
+	D int
+}
+
+type EmbeddedCycleA struct {
+	*EmbeddedCycleB
+	A int
+}
+
+type EmbeddedCycleB struct {
+	*EmbeddedCycleA
+	B int
+}
+
 type inlineD struct {
 	C *inlineC `yaml:",inline"`
 	D int
@@ -1045,6 +1123,52 @@ func TestDecoderReadError(t *testing.T) {
 	require.EqualError(t, err, `yaml: input error: some read error`)
 }
 
+func TestDecoderSetReadTimeout(t *testing.T) {
+	dec := yaml.NewDecoder(&slowReader{r: iotest.OneByteReader(strings.NewReader("a: 1\nb: [2, 3]\n")), delay: time.Millisecond})
+	dec.SetReadTimeout(time.Second)
+	var v map[string]interface{}
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{"a": 1, "b": []interface{}{2, 3}}, v)
+	require.Equal(t, io.EOF, dec.Decode(&v))
+
+	// The reader stalls in the middle of the document.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		_, _ = pw.Write([]byte("a: 1\nb: "))
+	}()
+	dec = yaml.NewDecoder(pr)
+	dec.SetReadTimeout(50 * time.Millisecond)
+	start := time.Now()
+	err := dec.Decode(&v)
+	require.EqualError(t, err, "yaml: input error: read timed out after 50ms")
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// Disabling the timeout restores the reader.
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\n"))
+	dec.SetReadTimeout(time.Second)
+	dec.SetReadTimeout(0)
+	v = nil
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{"a": 1}, v)
+}
+
+func TestDecoderMaxInputBytes(t *testing.T) {
+	data := "a: 1\n---\nb: " + strings.Repeat("x", 1000) + "\n"
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxInputBytes(100)
+	var v map[string]string
+	err := dec.Decode(&v)
+	require.EqualError(t, err, "yaml: input exceeds the maximum size of 100 bytes")
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxInputBytes(int64(len(data)))
+	require.NoError(t, dec.Decode(&v))
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, io.EOF, dec.Decode(&v))
+}
+
 func TestUnmarshalNaN(t *testing.T) {
 	value := map[string]interface{}{}
 	err := yaml.Unmarshal([]byte("notanum: .NaN"), &value)
@@ -1576,6 +1700,27 @@ func TestMergeStruct(t *testing.T) {
 	}
 }
 
+func TestMergeStringKey(t *testing.T) {
+	data := "anchor: &a {x: 1}\n" +
+		"quoted:\n  !!str \"<<\": value\n" +
+		"plain:\n  !!str <<: *a\n" +
+		"long:\n  !<tag:yaml.org,2002:str> <<: *a\n" +
+		"untagged:\n  \"<<\": *a\n"
+
+	var m map[string]map[string]interface{}
+	err := yaml.Unmarshal([]byte(data), &m)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"<<": "value"}, m["quoted"])
+	require.Equal(t, map[string]interface{}{"<<": map[string]interface{}{"x": 1}}, m["plain"])
+	require.Equal(t, map[string]interface{}{"<<": map[string]interface{}{"x": 1}}, m["long"])
+	require.Equal(t, map[string]interface{}{"<<": map[string]interface{}{"x": 1}}, m["untagged"])
+
+	var s map[string]struct{ X int }
+	err = yaml.Unmarshal([]byte(data), &s)
+	require.NoError(t, err)
+	require.Equal(t, 0, s["plain"].X)
+}
+
 var mergeTestsNested = `
 mergeouter1: &mergeouter1
     d: 40
@@ -1720,6 +1865,79 @@ func TestUnmarshalNull(t *testing.T) {
 	}
 }
 
+func TestUnmarshalRunes(t *testing.T) {
+	var v struct {
+		Word   []rune
+		Empty  []rune
+		Letter rune
+		Wide   rune
+		Digit  rune
+		Number rune
+	}
+	data := "word: h\u00e9llo \u4e16\u754c\nempty: ''\nletter: x\nwide: \u4e16\ndigit: '7'\nnumber: 7\n"
+	decode := func(data string, out interface{}) error {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetStringsAsRunes(true)
+		return dec.Decode(out)
+	}
+	require.NoError(t, decode(data, &v))
+	require.Equal(t, []rune("h\u00e9llo \u4e16\u754c"), v.Word)
+	require.Equal(t, []rune{}, v.Empty)
+	require.Equal(t, 'x', v.Letter)
+	require.Equal(t, '\u4e16', v.Wide)
+	require.Equal(t, '7', v.Digit)
+	require.Equal(t, rune(7), v.Number)
+
+	var r rune
+	err := decode("ab", &r)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `ab` into int32")
+
+	// Sequences still decode into []rune as numbers.
+	var runes []rune
+	require.NoError(t, decode("[104, 105]", &runes))
+	require.Equal(t, []rune("hi"), runes)
+
+	// Without the option strings don't decode into int32 values.
+	var n int32
+	err = yaml.Unmarshal([]byte("'3'"), &n)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `3` into int32")
+	var ids []int32
+	err = yaml.Unmarshal([]byte("abc"), &ids)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `abc` into []int32")
+}
+
+func TestUnmarshalMultiLevelPointers(t *testing.T) {
+	var v struct {
+		A **int
+		B ***string
+	}
+	require.NoError(t, yaml.Unmarshal([]byte("a: 1\nb: x\n"), &v))
+	require.NotNil(t, v.A)
+	require.NotNil(t, *v.A)
+	require.Equal(t, 1, **v.A)
+	require.NotNil(t, v.B)
+	require.NotNil(t, *v.B)
+	require.NotNil(t, **v.B)
+	require.Equal(t, "x", ***v.B)
+
+	// A null resets the outermost pointer rather than any inner level.
+	require.NoError(t, yaml.Unmarshal([]byte("a: null\nb: ~\n"), &v))
+	require.Nil(t, v.A)
+	require.Nil(t, v.B)
+
+	var p ***string
+	require.NoError(t, yaml.Unmarshal([]byte("x"), &p))
+	require.Equal(t, "x", ***p)
+	require.NoError(t, yaml.Unmarshal([]byte("null"), &p))
+	require.Nil(t, p)
+
+	var l []**int
+	require.NoError(t, yaml.Unmarshal([]byte("[1, null]"), &l))
+	require.Len(t, l, 2)
+	require.Equal(t, 1, **l[0])
+	require.Nil(t, l[1])
+}
+
 func TestUnmarshalPreservesData(t *testing.T) {
 	var v struct {
 		A, B int
@@ -1841,6 +2059,61 @@ func TestUnmarshalKnownFields(t *testing.T) {
 	}
 }
 
+func TestDecodeWithPresence(t *testing.T) {
+	type server struct {
+		Host string
+		Port int
+	}
+	var v struct {
+		Name    string
+		Port    int
+		Debug   bool
+		Servers []server
+		Labels  map[string]string
+	}
+	data := "port: 0\nservers:\n- host: a\n- port: 80\nlabels:\n  env: prod\n"
+	var present yaml.FieldSet
+	err := yaml.NewDecoder(strings.NewReader(data)).DecodeWithPresence(&v, &present)
+	require.NoError(t, err)
+	require.True(t, present.Has("port"))
+	require.False(t, present.Has("name"))
+	require.False(t, present.Has("debug"))
+	require.True(t, present.Has("servers.0.host"))
+	require.False(t, present.Has("servers.0.port"))
+	require.True(t, present.Has("servers.1.port"))
+	require.Equal(t, []string{
+		"labels",
+		"labels.env",
+		"port",
+		"servers",
+		"servers.0.host",
+		"servers.1.port",
+	}, present.Paths())
+}
+
+type enumColor string
+
+func TestRegisterEnum(t *testing.T) {
+	yaml.RegisterEnum[enumColor]("red", "green", "blue")
+
+	var v struct {
+		Color  enumColor
+		Counts map[enumColor]int
+	}
+	err := yaml.Unmarshal([]byte("color: green\ncounts: {red: 1, blue: 2}"), &v)
+	require.NoError(t, err)
+	require.Equal(t, enumColor("green"), v.Color)
+	require.Equal(t, map[enumColor]int{"red": 1, "blue": 2}, v.Counts)
+
+	v.Color = ""
+	err = yaml.Unmarshal([]byte("color: purple"), &v)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: invalid value \"purple\" for yaml_test.enumColor: must be one of \"red\", \"green\", \"blue\"")
+	require.Equal(t, enumColor(""), v.Color)
+
+	err = yaml.Unmarshal([]byte("color: Red"), &v)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: invalid value \"Red\" for yaml_test.enumColor: must be one of \"red\", \"green\", \"blue\"")
+}
+
 type textUnmarshaler struct {
 	S string
 }
@@ -1850,6 +2123,492 @@ func (t *textUnmarshaler) UnmarshalText(s []byte) error {
 	return nil
 }
 
+func TestDecoderSetOctalMode(t *testing.T) {
+	data := "a: 010\nb: 0o10\nc: -007\nd: 09\ne: 0\nf: !!float 010\ng: \"010\"\n"
+	tests := []struct {
+		mode yaml.OctalMode
+		want map[string]interface{}
+	}{
+		{
+			mode: yaml.Legacy11,
+			want: map[string]interface{}{"a": 8, "b": 8, "c": -7, "d": 9.0, "e": 0, "f": 8.0, "g": "010"},
+		},
+		{
+			mode: yaml.Strict12,
+			want: map[string]interface{}{"a": 10, "b": 8, "c": -7, "d": 9, "e": 0, "f": 10.0, "g": "010"},
+		},
+	}
+	for _, test := range tests {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetOctalMode(test.mode)
+		var got map[string]interface{}
+		err := dec.Decode(&got)
+		require.NoError(t, err)
+		require.Equal(t, test.want, got)
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader("id: 0123\n"))
+	dec.SetOctalMode(yaml.Strict12)
+	var v struct{ ID int }
+	err := dec.Decode(&v)
+	require.NoError(t, err)
+	require.Equal(t, 123, v.ID)
+}
+
+func TestDecoderSetKeepTaggedAsNode(t *testing.T) {
+	data := "a: !custom foo\nb: 1\nc: !!str 2\nd: !point {x: 1}\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetKeepTaggedAsNode(true)
+	var got map[string]interface{}
+	err := dec.Decode(&got)
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+	require.Equal(t, 1, got["b"])
+	require.Equal(t, "2", got["c"])
+	a, ok := got["a"].(*yaml.Node)
+	require.True(t, ok)
+	require.Equal(t, "!custom", a.Tag)
+	require.Equal(t, "foo", a.Value)
+	d, ok := got["d"].(*yaml.Node)
+	require.True(t, ok)
+	require.Equal(t, "!point", d.Tag)
+	require.Equal(t, yaml.MappingNode, d.Kind)
+
+	// Without the option the tag is dropped.
+	got = nil
+	err = yaml.Unmarshal([]byte(data), &got)
+	require.NoError(t, err)
+	require.Equal(t, "foo", got["a"])
+}
+
+func TestSyntaxError(t *testing.T) {
+	var v map[string]int
+	err := yaml.Unmarshal([]byte("a: 1\nb: [2\n"), &v)
+	require.EqualError(t, err, "yaml: line 1: did not find expected ',' or ']'")
+	var syntaxErr *yaml.SyntaxError
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Equal(t, yaml.ParserError, syntaxErr.Kind)
+	require.Equal(t, 2, syntaxErr.Line)
+	require.Equal(t, 4, syntaxErr.Column)
+	require.Equal(t, "did not find expected ',' or ']'", syntaxErr.Problem)
+	var typeErr *yaml.TypeError
+	require.False(t, errors.As(err, &typeErr))
+
+	err = yaml.Unmarshal([]byte("a: x\n"), &v)
+	require.Error(t, err)
+	require.True(t, errors.As(err, &typeErr))
+	require.False(t, errors.As(err, &syntaxErr))
+
+	err = yaml.Unmarshal([]byte("a: \x01\n"), &v)
+	require.EqualError(t, err, "yaml: control characters are not allowed")
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Equal(t, yaml.ReaderError, syntaxErr.Kind)
+	require.Equal(t, 0, syntaxErr.Line)
+
+	err = yaml.Unmarshal([]byte("a: @b\n"), &v)
+	require.EqualError(t, err, "yaml: found character that cannot start any token")
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Equal(t, yaml.ScannerError, syntaxErr.Kind)
+	require.Equal(t, 1, syntaxErr.Line)
+	require.Equal(t, 4, syntaxErr.Column)
+}
+
+func TestMultiDocumentErrorLines(t *testing.T) {
+	tests := []struct {
+		data  string
+		error string
+	}{
+		{
+			data:  "a: 1\n---\nb: 2\nc: 3\n---\nd: 1\n d: 2\n",
+			error: "yaml: line 7: mapping values are not allowed in this context",
+		},
+		{
+			data:  "a: 1\n---\nb: 2\nc: 3\n---\nd: x\n",
+			error: "yaml: unmarshal errors:\n  line 6: cannot unmarshal !!str `x` into int",
+		},
+	}
+	for _, test := range tests {
+		dec := yaml.NewDecoder(strings.NewReader(test.data))
+		var err error
+		for i := 0; i < 3 && err == nil; i++ {
+			var v map[string]int
+			err = dec.Decode(&v)
+		}
+		require.EqualError(t, err, test.error)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	version, tags, err := yaml.Directives([]byte("%YAML 1.1\n%TAG !e! tag:example.com,2000:\n---\na: !e!foo [\n"))
+	require.NoError(t, err)
+	require.Equal(t, &yaml.VersionDirective{Major: 1, Minor: 1}, version)
+	require.Equal(t, []yaml.TagDirective{{Handle: []byte("!e!"), Prefix: []byte("tag:example.com,2000:")}}, tags)
+
+	version, tags, err = yaml.Directives([]byte("a: 1\n"))
+	require.NoError(t, err)
+	require.Nil(t, version)
+	require.Empty(t, tags)
+
+	_, _, err = yaml.Directives([]byte("%YAML 2.0\n---\n"))
+	require.Error(t, err)
+}
+
+// commentedReader produces a sequence of n commented mappings, recording
+// the live heap after 1000 items and at the end of the stream.
+type commentedReader struct {
+	n, i       int
+	buf        []byte
+	start, end uint64
+}
+
+func (r *commentedReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.i == 1000 || r.i == r.n {
+			var stats runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if r.i == 1000 {
+				r.start = stats.HeapAlloc
+			} else {
+				r.end = stats.HeapAlloc
+			}
+		}
+		if r.i == r.n {
+			return 0, io.EOF
+		}
+		r.buf = []byte(fmt.Sprintf("# Item %d.\n- id: %d # The id.\n  tags: [a, b]\n  text: |\n    some text\n", r.i, r.i))
+		r.i++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestValidateReader(t *testing.T) {
+	r := &commentedReader{n: 200000}
+	require.NoError(t, yaml.ValidateReader(r))
+	require.Less(t, r.end, r.start+4<<20)
+
+	require.NoError(t, yaml.ValidateReader(strings.NewReader("a: 1\n---\n- b\n")))
+	require.NoError(t, yaml.ValidateReader(strings.NewReader("")))
+
+	err := yaml.ValidateReader(io.MultiReader(&commentedReader{n: 1000}, strings.NewReader("- a: @b\n")))
+	require.EqualError(t, err, "yaml: line 5001: found character that cannot start any token")
+
+	err = yaml.ValidateReader(strings.NewReader("a: 1\nb: [1, 2\n"))
+	require.Error(t, err)
+	var syntaxErr *yaml.SyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+}
+
+func TestComplexity(t *testing.T) {
+	data := "base: &b\n  x: 1\n  y: [1, 2]\nitems:\n  - *b\n  - {z: [3]}\n---\nscalar\n"
+	nodes, maxDepth, aliases, err := yaml.Complexity([]byte(data))
+	require.NoError(t, err)
+	require.Equal(t, 17, nodes)
+	require.Equal(t, 4, maxDepth)
+	require.Equal(t, 1, aliases)
+
+	nodes, maxDepth, aliases, err = yaml.Complexity([]byte("a\n"))
+	require.NoError(t, err)
+	require.Equal(t, [3]int{1, 0, 0}, [3]int{nodes, maxDepth, aliases})
+
+	nodes, maxDepth, aliases, err = yaml.Complexity(nil)
+	require.NoError(t, err)
+	require.Equal(t, [3]int{0, 0, 0}, [3]int{nodes, maxDepth, aliases})
+
+	_, _, _, err = yaml.Complexity([]byte("a: 1\nb: [1, 2\n"))
+	var syntaxErr *yaml.SyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+}
+
+type taggedShape struct {
+	Tag   string `yaml:",tag"`
+	Sides int
+}
+
+func TestUnmarshalTagField(t *testing.T) {
+	var shapes []taggedShape
+	err := yaml.Unmarshal([]byte("- !shape {sides: 3}\n- {sides: 4}\n"), &shapes)
+	require.NoError(t, err)
+	require.Equal(t, []taggedShape{{Tag: "!shape", Sides: 3}, {Tag: "!!map", Sides: 4}}, shapes)
+
+	out, err := yaml.Marshal(shapes)
+	require.NoError(t, err)
+	require.Equal(t, "- !shape\n  sides: 3\n- sides: 4\n", string(out))
+
+	var bad struct {
+		Tag int `yaml:",tag"`
+	}
+	require.Panics(t, func() {
+		_ = yaml.Unmarshal([]byte("{}"), &bad) //nolint:errcheck // expected to panic
+	})
+}
+
+type lineServer struct {
+	Host     string
+	Port     int
+	PortLine int `yaml:"port,line"`
+}
+
+func TestUnmarshalLineField(t *testing.T) {
+	data := "# servers\nhost: example.com\n\nport: 8080\n"
+	var v lineServer
+	err := yaml.Unmarshal([]byte(data), &v)
+	require.NoError(t, err)
+	require.Equal(t, lineServer{Host: "example.com", Port: 8080, PortLine: 4}, v)
+
+	var node yaml.Node
+	err = yaml.Unmarshal([]byte(data), &node)
+	require.NoError(t, err)
+	require.Equal(t, node.Content[0].Content[3].Line, v.PortLine)
+
+	var inlined struct {
+		Server *lineServer `yaml:",inline"`
+		Name   string
+	}
+	err = yaml.Unmarshal([]byte("name: web\nport:\n  8080\n"), &inlined)
+	require.NoError(t, err)
+	require.Equal(t, &lineServer{Port: 8080, PortLine: 3}, inlined.Server)
+
+	out, err := yaml.Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, "host: example.com\nport: 8080\n", string(out))
+
+	var bad struct {
+		Port     int
+		PortLine string `yaml:"port,line"`
+	}
+	require.Panics(t, func() {
+		_ = yaml.Unmarshal([]byte("{}"), &bad) //nolint:errcheck // expected to panic
+	})
+}
+
+func TestUnmarshalRepeatedField(t *testing.T) {
+	type request struct {
+		Method  string
+		Headers []string `yaml:"header,repeated"`
+	}
+	data := "method: GET\nheader: 'Accept: text/plain'\nheader: 'Host: example.com'\nheader: 'X-Trace: 1'\n"
+	v := request{Headers: []string{"stale"}}
+	err := yaml.Unmarshal([]byte(data), &v)
+	require.NoError(t, err)
+	require.Equal(t, request{Method: "GET", Headers: []string{"Accept: text/plain", "Host: example.com", "X-Trace: 1"}}, v)
+
+	out, err := yaml.Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, data, string(out))
+	var got request
+	require.NoError(t, yaml.Unmarshal(out, &got))
+	require.Equal(t, v, got)
+
+	err = yaml.Unmarshal([]byte("method: GET\nmethod: POST\n"), &got)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 2: mapping key \"method\" already defined at line 1")
+
+	var bad struct {
+		Header string `yaml:"header,repeated"`
+	}
+	require.Panics(t, func() {
+		_ = yaml.Unmarshal([]byte("{}"), &bad) //nolint:errcheck // expected to panic
+	})
+}
+
+type genericList[T any] []T
+
+type genericSet[T comparable] map[T]struct{}
+
+type genericPair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// genericStack holds its items in reverse order.
+type genericStack[T any] struct {
+	items []T
+}
+
+func (s *genericStack[T]) UnmarshalYAML(value *yaml.Node) error {
+	var items []T
+	err := value.Decode(&items)
+	if err != nil {
+		return err
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		s.items = append(s.items, items[i])
+	}
+	return nil
+}
+
+func TestUnmarshalGenericTypes(t *testing.T) {
+	var list genericList[int]
+	require.NoError(t, yaml.Unmarshal([]byte("[1, 2, 3]"), &list))
+	require.Equal(t, genericList[int]{1, 2, 3}, list)
+
+	var set genericSet[string]
+	require.NoError(t, yaml.Unmarshal([]byte("--- !!set\n? a\n? b\n"), &set))
+	require.Equal(t, genericSet[string]{"a": {}, "b": {}}, set)
+
+	var pairs []genericPair[string, genericList[float64]]
+	require.NoError(t, yaml.Unmarshal([]byte("- {key: a, value: [1.5]}\n- {key: b}\n"), &pairs))
+	require.Equal(t, []genericPair[string, genericList[float64]]{{"a", genericList[float64]{1.5}}, {Key: "b"}}, pairs)
+
+	var stacks map[string]genericStack[string]
+	require.NoError(t, yaml.Unmarshal([]byte("s: [x, y, z]\n"), &stacks))
+	require.Equal(t, []string{"z", "y", "x"}, stacks["s"].items)
+
+	err := yaml.Unmarshal([]byte("[1, a]"), &list)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `a` into int")
+}
+
+// namedStringMap is not decoded through the map[string]string fast path.
+type namedStringMap map[string]string
+
+func TestUnmarshalStringMapFastPath(t *testing.T) {
+	data := "a: b\n'c': \"d\"\n1: 2\ne: ~\nf: true\ng: !!str 3\nh: |\n  text\n<<: {i: j}\nk: &x y\nl: *x\n"
+
+	var want namedStringMap
+	err := yaml.Unmarshal([]byte(data), &want)
+	require.NoError(t, err)
+	var got map[string]string
+	err = yaml.Unmarshal([]byte(data), &got)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string(want), got)
+
+	var wantIface map[interface{}]interface{}
+	err = yaml.Unmarshal([]byte(data), &wantIface)
+	require.NoError(t, err)
+	var gotIface map[string]interface{}
+	err = yaml.Unmarshal([]byte(data), &gotIface)
+	require.NoError(t, err)
+	require.Len(t, gotIface, len(wantIface))
+	for k, v := range wantIface {
+		require.Equal(t, v, gotIface[fmt.Sprint(k)])
+	}
+}
+
+func BenchmarkUnmarshalStringMap(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, "key%d: value %d\n", i, i)
+	}
+	data := buf.Bytes()
+	b.Run("map[string]string", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var v map[string]string
+			err := yaml.Unmarshal(data, &v)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("named map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var v namedStringMap
+			err := yaml.Unmarshal(data, &v)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDecoderSetPrecisionLossError(t *testing.T) {
+	type floats struct {
+		F32 float32
+		F64 float64
+	}
+	tests := []struct {
+		data  string
+		want  floats
+		error string
+	}{
+		{data: "f32: 16777216\nf64: 9007199254740992", want: floats{F32: 16777216, F64: 9007199254740992}},
+		{data: "f32: 0.5\nf64: 0.1", want: floats{F32: 0.5, F64: 0.1}},
+		{data: "f32: 18446744073709551616", want: floats{F32: float32(math.MaxUint64 + 1)}},
+		{data: "f32: .inf\nf64: .nan", want: floats{F32: float32(math.Inf(1)), F64: math.NaN()}},
+		{
+			data:  "f32: 16777217",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!int `16777217` into float32",
+		},
+		{
+			data:  "f32: 18446744073709551615",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!int `1844674...` into float32",
+		},
+		{
+			data:  "f32: 0.1",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `0.1` into float32",
+		},
+		{
+			data:  "f32: 1e39",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `1e39` into float32",
+		},
+		{
+			data:  "f64: 9007199254740993",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!int `9007199...` into float64",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			var lossy floats
+			err := yaml.Unmarshal([]byte(test.data), &lossy)
+			require.NoError(t, err)
+
+			dec := yaml.NewDecoder(strings.NewReader(test.data))
+			dec.SetPrecisionLossError(true)
+			var got floats
+			err = dec.Decode(&got)
+			if test.error != "" {
+				require.EqualError(t, err, test.error)
+				return
+			}
+			require.NoError(t, err)
+			if math.IsNaN(test.want.F64) {
+				require.True(t, math.IsNaN(got.F64))
+				got.F64, test.want.F64 = 0, 0
+			}
+			require.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestIndentlessSequenceFootComment(t *testing.T) {
+	// A foot comment directly after the last item of an indentless sequence
+	// that ends the document belongs to that item, and a blank line before
+	// the comment moves it to the document. When another key follows, the
+	// comment is at the indentation of that key, so it is the key's head
+	// comment instead, blank line or not.
+	tests := []struct {
+		data     string
+		itemFoot string
+		docFoot  string
+		nextHead string
+	}{
+		{data: "key:\n- a\n- b\n# foot\n", itemFoot: "# foot"},
+		{data: "key:\n  - a\n  - b\n  # foot\n", itemFoot: "# foot"},
+		{data: "key:\n- a\n- b\n\n# foot\n", docFoot: "# foot"},
+		{data: "key:\n- a\n- b\n# foot\nnext: c\n", nextHead: "# foot"},
+		{data: "key:\n  - a\n  - b\n  # foot\nnext: c\n", itemFoot: "# foot"},
+		{data: "key:\n- a\n- b\n\n# foot\nnext: c\n", nextHead: "# foot"},
+	}
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			var node yaml.Node
+			err := yaml.Unmarshal([]byte(test.data), &node)
+			require.NoError(t, err)
+			require.Equal(t, test.docFoot, node.FootComment)
+			mapping := node.Content[0]
+			require.Equal(t, "", mapping.FootComment)
+			seq := mapping.Content[1]
+			require.Equal(t, "", seq.FootComment)
+			require.Equal(t, test.itemFoot, seq.Content[1].FootComment)
+			require.Equal(t, "", seq.Content[0].FootComment)
+			if len(mapping.Content) > 2 {
+				require.Equal(t, test.nextHead, mapping.Content[2].HeadComment)
+			}
+		})
+	}
+}
+
 func TestFuzzCrashers(t *testing.T) {
 	cases := []string{
 		// runtime error: index out of range
@@ -1879,3 +2638,1262 @@ func TestFuzzCrashers(t *testing.T) {
 		_ = yaml.Unmarshal([]byte(s), &v)
 	}
 }
+
+func TestDecoderSetStringKeys(t *testing.T) {
+	data := "on: a\n123: b\nnull: c\n!!int 7: d\nnested: {off: e}\n"
+
+	var v map[string]interface{}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetStringKeys(true)
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{
+		"on":     "a",
+		"123":    "b",
+		"null":   "c",
+		"7":      "d",
+		"nested": map[string]interface{}{"off": "e"},
+	}, v)
+
+	var iface interface{}
+	dec = yaml.NewDecoder(strings.NewReader("123: b\nnull: c\n"))
+	dec.SetStringKeys(true)
+	require.NoError(t, dec.Decode(&iface))
+	require.Equal(t, map[string]interface{}{"123": "b", "null": "c"}, iface)
+
+	iface = nil
+	require.NoError(t, yaml.Unmarshal([]byte("123: b\n"), &iface))
+	require.Equal(t, map[interface{}]interface{}{123: "b"}, iface)
+}
+
+// sequenceReader generates a sequence of n mappings without holding it in
+// memory.
+type sequenceReader struct {
+	n, i int
+	buf  []byte
+}
+
+func (r *sequenceReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.i == r.n {
+			return 0, io.EOF
+		}
+		r.buf = []byte(fmt.Sprintf("- {id: %d, name: item}\n", r.i))
+		r.i++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestDecoderDecodeSequence(t *testing.T) {
+	dec := yaml.NewDecoder(strings.NewReader("- a\n- &b {x: 1}\n- *b\n---\n[c]\n---\nd: 1\n"))
+	var items []string
+	err := dec.DecodeSequence(func(item *yaml.Node) error {
+		var v interface{}
+		err := item.Decode(&v)
+		items = append(items, fmt.Sprint(v))
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "map[x:1]", "map[x:1]"}, items)
+
+	err = dec.DecodeSequence(func(item *yaml.Node) error {
+		return errors.New("stop")
+	})
+	require.EqualError(t, err, "stop")
+
+	dec = yaml.NewDecoder(strings.NewReader("d: 1\n"))
+	err = dec.DecodeSequence(func(item *yaml.Node) error { return nil })
+	require.EqualError(t, err, "yaml: line 1: document root is not a sequence")
+
+	// After a failure, the next call reads the next document.
+	dec = yaml.NewDecoder(strings.NewReader("d: [1]\n---\n- [a, b]\n- c\n---\n- e\n"))
+	err = dec.DecodeSequence(func(item *yaml.Node) error { return nil })
+	require.EqualError(t, err, "yaml: line 1: document root is not a sequence")
+	err = dec.DecodeSequence(func(item *yaml.Node) error {
+		return errors.New("stop")
+	})
+	require.EqualError(t, err, "stop")
+	items = nil
+	err = dec.DecodeSequence(func(item *yaml.Node) error {
+		items = append(items, item.Value)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"e"}, items)
+
+	dec = yaml.NewDecoder(strings.NewReader(""))
+	err = dec.DecodeSequence(func(item *yaml.Node) error { return nil })
+	require.Equal(t, io.EOF, err)
+}
+
+func TestDecoderDecodeSequenceMemory(t *testing.T) {
+	const n = 200000
+	var stats runtime.MemStats
+	var start uint64
+	count := 0
+	dec := yaml.NewDecoder(&sequenceReader{n: n})
+	err := dec.DecodeSequence(func(item *yaml.Node) error {
+		var v struct{ ID int }
+		err := item.Decode(&v)
+		if err != nil {
+			return err
+		}
+		require.Equal(t, count, v.ID)
+		count++
+		if count == 1000 || count == n {
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if count == 1000 {
+				start = stats.HeapAlloc
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, n, count)
+	require.Less(t, stats.HeapAlloc, start+4<<20)
+}
+
+// mappingReader generates a mapping of n entries without holding it in
+// memory.
+type mappingReader struct {
+	n, i int
+	buf  []byte
+}
+
+func (r *mappingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.i == r.n {
+			return 0, io.EOF
+		}
+		r.buf = []byte(fmt.Sprintf("key%d: {id: %d, name: item}\n", r.i, r.i))
+		r.i++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestDecoderDecodeMapping(t *testing.T) {
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: &b {x: 1}\n# foot\n\nc: *b\n&k d: [2]\n---\n{e: f}\n---\n- g\n"))
+	var entries []string
+	err := dec.DecodeMapping(func(key string, value *yaml.Node) error {
+		var v interface{}
+		err := value.Decode(&v)
+		entries = append(entries, fmt.Sprint(key, "=", v))
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a=1", "b=map[x:1]", "c=map[x:1]", "d=[2]"}, entries)
+
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error {
+		return errors.New("stop")
+	})
+	require.EqualError(t, err, "stop")
+
+	dec = yaml.NewDecoder(strings.NewReader("- g\n"))
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error { return nil })
+	require.EqualError(t, err, "yaml: line 1: document root is not a mapping")
+
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\n[b]: 2\n"))
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error { return nil })
+	require.EqualError(t, err, "yaml: line 2: mapping key is not a scalar")
+
+	// After a failure, the next call reads the next document.
+	dec = yaml.NewDecoder(strings.NewReader("- {a: 1}\n---\na: {b: 1}\nc: 2\n---\n[x]: 1\ny: 2\n---\nd: 3\n"))
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error { return nil })
+	require.EqualError(t, err, "yaml: line 1: document root is not a mapping")
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error {
+		return errors.New("stop")
+	})
+	require.EqualError(t, err, "stop")
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error { return nil })
+	require.EqualError(t, err, "yaml: line 6: mapping key is not a scalar")
+	entries = nil
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error {
+		entries = append(entries, key+"="+value.Value)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"d=3"}, entries)
+
+	// Duplicate keys are passed to fn as they come.
+	var keys []string
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\nb: 2\n'a': 3\n"))
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error {
+		keys = append(keys, key+"="+value.Value)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a=1", "b=2", "a=3"}, keys)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\nb: 2\nc: 3\n"))
+	dec.SetMaxMapEntries(2)
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error { return nil })
+	require.EqualError(t, err, "yaml: line 1: mapping exceeds the maximum of 2 entries")
+
+	dec = yaml.NewDecoder(strings.NewReader(""))
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error { return nil })
+	require.Equal(t, io.EOF, err)
+}
+
+func TestDecoderDecodeMappingMemory(t *testing.T) {
+	const n = 200000
+	var stats runtime.MemStats
+	var start uint64
+	count := 0
+	dec := yaml.NewDecoder(&mappingReader{n: n})
+	err := dec.DecodeMapping(func(key string, value *yaml.Node) error {
+		var v struct{ ID int }
+		err := value.Decode(&v)
+		if err != nil {
+			return err
+		}
+		require.Equal(t, fmt.Sprintf("key%d", count), key)
+		require.Equal(t, count, v.ID)
+		count++
+		if count == 1000 || count == n {
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if count == 1000 {
+				start = stats.HeapAlloc
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, n, count)
+	require.Less(t, stats.HeapAlloc, start+4<<20)
+}
+
+func TestDecoderSetStringInterning(t *testing.T) {
+	data := strings.Repeat("- {color: red, size: large}\n", 100)
+	for _, interning := range []bool{false, true} {
+		var v []map[string]interface{}
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetStringInterning(interning)
+		require.NoError(t, dec.Decode(&v))
+		require.Len(t, v, 100)
+		colors := map[*byte]bool{}
+		for _, m := range v {
+			require.Equal(t, map[string]interface{}{"color": "red", "size": "large"}, m)
+			colors[unsafe.StringData(m["color"].(string))] = true
+		}
+		if interning {
+			require.Len(t, colors, 1)
+		} else {
+			require.Len(t, colors, 100)
+		}
+	}
+}
+
+func BenchmarkDecodeStringInterning(b *testing.B) {
+	data := []byte(strings.Repeat("- {status: awaiting review by the operations team, region: europe-west}\n", 10000))
+	for _, interning := range []bool{false, true} {
+		b.Run(fmt.Sprintf("interning=%v", interning), func(b *testing.B) {
+			b.ReportAllocs()
+			var retained uint64
+			decode := func() (v []map[string]string) {
+				dec := yaml.NewDecoder(bytes.NewReader(data))
+				dec.SetStringInterning(interning)
+				err := dec.Decode(&v)
+				if err != nil {
+					b.Fatal(err)
+				}
+				return v
+			}
+			var stats runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			base := stats.HeapAlloc
+			for i := 0; i < b.N; i++ {
+				v := decode()
+				runtime.GC()
+				runtime.ReadMemStats(&stats)
+				retained += stats.HeapAlloc - base
+				runtime.KeepAlive(v)
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
+
+func TestDecoderSetComplexKeyMode(t *testing.T) {
+	data := "[a, 1]: seq\n{b: [c, \"d e\"]}: map\n&k [x]: anchored\n*k : alias\nplain: scalar\n"
+
+	var v map[string]interface{}
+	err := yaml.Unmarshal([]byte(data), &v)
+	require.Error(t, err)
+
+	v = nil
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetComplexKeyMode(yaml.ComplexKeyStringify)
+	err = dec.Decode(&v)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 4: mapping key \"[x]\" already defined at line 3")
+
+	v = nil
+	dec = yaml.NewDecoder(strings.NewReader("[a, 1]: seq\n{b: [c, \"d e\"]}: map\n? - x\n  - {y: z}\n: block\nplain: scalar\n"))
+	dec.SetComplexKeyMode(yaml.ComplexKeyStringify)
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{
+		"[a, 1]":          "seq",
+		`{b: [c, "d e"]}`: "map",
+		"[x, {y: z}]":     "block",
+		"plain":           "scalar",
+	}, v)
+
+	var iface interface{}
+	dec = yaml.NewDecoder(strings.NewReader("[a]: 1\n&k {b: 2}: 3\nc: *k\n"))
+	dec.SetComplexKeyMode(yaml.ComplexKeyStringify)
+	require.NoError(t, dec.Decode(&iface))
+	require.Equal(t, map[string]interface{}{
+		"[a]":    1,
+		"{b: 2}": 3,
+		"c":      map[string]interface{}{"b": 2},
+	}, iface)
+}
+
+type compressor interface {
+	Compress([]byte) []byte
+}
+
+type gzipCompressor struct{ level int }
+
+func (gzipCompressor) Compress(b []byte) []byte { return b }
+
+func TestDecoderSetFactory(t *testing.T) {
+	type config struct {
+		Handler  compressor
+		Handlers []compressor
+		Optional compressor
+	}
+	factory := func(name string) (interface{}, error) {
+		switch name {
+		case "gzip":
+			return gzipCompressor{level: 6}, nil
+		case "bad":
+			return "not a compressor", nil
+		}
+		return nil, fmt.Errorf("unknown compressor %q", name)
+	}
+	decode := func(data string) (config, error) {
+		var c config
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetFactory(reflect.TypeOf((*compressor)(nil)).Elem(), factory)
+		err := dec.Decode(&c)
+		return c, err
+	}
+
+	c, err := decode("handler: gzip\nhandlers: [gzip, gzip]\noptional: null\n")
+	require.NoError(t, err)
+	require.Equal(t, config{
+		Handler:  gzipCompressor{level: 6},
+		Handlers: []compressor{gzipCompressor{level: 6}, gzipCompressor{level: 6}},
+	}, c)
+
+	_, err = decode("handler: gzip\nhandlers:\n  - zstd\n")
+	require.EqualError(t, err, `yaml: line 3: unknown compressor "zstd"`)
+
+	_, err = decode("handler: bad\n")
+	require.EqualError(t, err, "yaml: line 1: factory for yaml_test.compressor returned string")
+
+	errUnavailable := errors.New("unavailable")
+	factory = func(name string) (interface{}, error) { return nil, errUnavailable }
+	_, err = decode("handler: gzip\n")
+	require.ErrorIs(t, err, errUnavailable)
+}
+
+type hintedUser struct {
+	Name  string
+	Admin bool
+}
+
+func (u hintedUser) Compress(data []byte) []byte { return data }
+
+func TestDecoderSetTypeHints(t *testing.T) {
+	data := "owner: !user {name: ann, admin: true}\n" +
+		"members:\n- !user {name: bob}\n- !<tag:example.com,2023:user> {name: cid}\n- !group {name: ops}\n" +
+		"handler: !user {name: dan}\n" +
+		"plain: {name: eve}\n"
+	type team struct {
+		Owner   interface{}
+		Members []interface{}
+		Handler compressor
+		Plain   interface{}
+	}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetTypeHints(map[string]reflect.Type{
+		"!user":                     reflect.TypeOf(hintedUser{}),
+		"tag:example.com,2023:user": reflect.TypeOf(&hintedUser{}),
+	})
+	var got team
+	require.NoError(t, dec.Decode(&got))
+	require.Equal(t, team{
+		Owner: hintedUser{Name: "ann", Admin: true},
+		Members: []interface{}{
+			hintedUser{Name: "bob"},
+			&hintedUser{Name: "cid"},
+			map[string]interface{}{"name": "ops"},
+		},
+		Handler: hintedUser{Name: "dan"},
+		Plain:   map[string]interface{}{"name": "eve"},
+	}, got)
+
+	var without map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &without))
+	require.Equal(t, map[string]interface{}{"name": "ann", "admin": true}, without["owner"])
+}
+
+// slowReader counts the reads made from it and makes each of them take
+// some time, like reads from a file or network connection.
+type slowReader struct {
+	r     io.Reader
+	reads int
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	r.reads++
+	time.Sleep(r.delay)
+	return r.r.Read(p)
+}
+
+func TestDecoderSetReadBufferSize(t *testing.T) {
+	data := strings.Repeat("- {id: 1, name: \"café\"}\n", 1000)
+	var want []map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &want))
+	reads := map[int]int{}
+	for _, size := range []int{0, 512, 4096, 1 << 20} {
+		r := &slowReader{r: strings.NewReader(data)}
+		dec := yaml.NewDecoder(r)
+		dec.SetReadBufferSize(size)
+		var got []map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		require.Equal(t, want, got)
+		reads[size] = r.reads
+	}
+	require.Equal(t, reads[0], reads[512])
+	require.Less(t, reads[4096], reads[512])
+	require.Equal(t, 2, reads[1<<20])
+}
+
+func BenchmarkDecoderSetReadBufferSize(b *testing.B) {
+	data := strings.Repeat("- {id: 1, name: item, tags: [a, b, c]}\n", 10000)
+	for _, size := range []int{512, 4096, 65536} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			var reads int
+			for i := 0; i < b.N; i++ {
+				r := &slowReader{r: strings.NewReader(data), delay: 10 * time.Microsecond}
+				dec := yaml.NewDecoder(r)
+				dec.SetReadBufferSize(size)
+				var v []map[string]interface{}
+				err := dec.Decode(&v)
+				if err != nil {
+					b.Fatal(err)
+				}
+				reads += r.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+func TestDecoderSetTrimTrailingSpace(t *testing.T) {
+	data := "a: foo \t\nb: foo\u00a0\u3000\nc: foo  \n  bar\u00a0 \nd: 1\u00a0\ne: 'foo\u00a0'\nf: |\n  foo\u00a0\n"
+	var v map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &v))
+	require.Equal(t, map[string]interface{}{
+		"a": "foo",
+		"b": "foo\u00a0\u3000",
+		"c": "foo bar\u00a0",
+		"d": "1\u00a0",
+		"e": "foo\u00a0",
+		"f": "foo\u00a0\n",
+	}, v)
+
+	v = nil
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetTrimTrailingSpace(true)
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{
+		"a": "foo",
+		"b": "foo",
+		"c": "foo bar",
+		"d": 1,
+		"e": "foo\u00a0",
+		"f": "foo\u00a0\n",
+	}, v)
+}
+
+func TestDecoderSetNonSpecificTagMode(t *testing.T) {
+	data := "a: ! 123\nb: ! true\nc: ! test\nd: ! '1'\ne: ! [1]\nf: 123\n"
+	tests := []struct {
+		mode yaml.NonSpecificTagMode
+		want map[string]interface{}
+	}{
+		{yaml.NonSpecificResolve, map[string]interface{}{"a": 123, "b": true, "c": "test", "d": "1", "e": []interface{}{1}, "f": 123}},
+		{yaml.NonSpecificAsString, map[string]interface{}{"a": "123", "b": "true", "c": "test", "d": "1", "e": []interface{}{1}, "f": 123}},
+	}
+	for _, test := range tests {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetNonSpecificTagMode(test.mode)
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		require.Equal(t, test.want, got)
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetNonSpecificTagMode(yaml.NonSpecificAsString)
+	var doc yaml.Node
+	require.NoError(t, dec.Decode(&doc))
+	out, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+	require.Equal(t, "a: \"123\"\nb: \"true\"\nc: test\nd: '1'\ne: [1]\nf: 123\n", string(out))
+}
+
+func TestDecoderSetLenientDirectives(t *testing.T) {
+	decode := func(data string, lenient bool) (*yaml.Node, error) {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetLenientDirectives(lenient)
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		return &doc, err
+	}
+
+	versions := "%YAML 1.1\n%YAML 1.1\n---\na: 1\n"
+	_, err := decode(versions, false)
+	require.EqualError(t, err, "yaml: line 1: found duplicate %YAML directive")
+	doc, err := decode(versions, true)
+	require.NoError(t, err)
+	require.Equal(t, "a", doc.Content[0].Content[0].Value)
+
+	tags := "%TAG !e! tag:a.example,2000:\n%TAG !e! tag:b.example,2000:\n---\n!e!x 1\n"
+	_, err = decode(tags, false)
+	require.EqualError(t, err, "yaml: line 1: found duplicate %TAG directive")
+	doc, err = decode(tags, true)
+	require.NoError(t, err)
+	require.Equal(t, "tag:b.example,2000:x", doc.Content[0].Tag)
+
+	// Directives for distinct handles are unaffected.
+	doc, err = decode("%TAG !a! tag:a.example,2000:\n%TAG !b! tag:b.example,2000:\n---\n[!a!x 1, !b!y 2]\n", true)
+	require.NoError(t, err)
+	require.Equal(t, "tag:a.example,2000:x", doc.Content[0].Content[0].Tag)
+	require.Equal(t, "tag:b.example,2000:y", doc.Content[0].Content[1].Tag)
+}
+
+func TestDecoderRegisterValidator(t *testing.T) {
+	type listener struct {
+		Host  string
+		Port  int      `yaml:"port,validate=port"`
+		Ports []int    `yaml:"extra,repeated,validate=port"`
+		Tags  []string `yaml:"tags,validate=nonempty"`
+	}
+	portRange := func(v reflect.Value) error {
+		if p := v.Int(); p < 1 || p > 65535 {
+			return fmt.Errorf("port %d out of range", p)
+		}
+		return nil
+	}
+	nonEmpty := func(v reflect.Value) error {
+		if v.Len() == 0 {
+			return errors.New("must not be empty")
+		}
+		return nil
+	}
+	decode := func(data string) (listener, error) {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.RegisterValidator("port", portRange)
+		dec.RegisterValidator("nonempty", nonEmpty)
+		var v listener
+		err := dec.Decode(&v)
+		return v, err
+	}
+
+	v, err := decode("host: localhost\nport: 8080\nextra: 9090\ntags: [a]\n")
+	require.NoError(t, err)
+	require.Equal(t, listener{Host: "localhost", Port: 8080, Ports: []int{9090}, Tags: []string{"a"}}, v)
+
+	v, err = decode("host: localhost\nport: 70000\nextra: 1\nextra: 0\ntags: []\n")
+	require.EqualError(t, err, "yaml: unmarshal errors:\n"+
+		"  line 2: invalid value for field port in type yaml_test.listener: port 70000 out of range\n"+
+		"  line 4: invalid value for field extra in type yaml_test.listener: port 0 out of range\n"+
+		"  line 5: invalid value for field tags in type yaml_test.listener: must not be empty")
+	require.Equal(t, "localhost", v.Host)
+
+	// Repeated fields are validated one element at a time, and other
+	// slices as a whole.
+	var kinds []reflect.Kind
+	dec := yaml.NewDecoder(strings.NewReader("extra: 1\nextra: 2\ntags: [a, b]\n"))
+	record := func(v reflect.Value) error {
+		kinds = append(kinds, v.Kind())
+		return nil
+	}
+	dec.RegisterValidator("port", record)
+	dec.RegisterValidator("nonempty", record)
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, []reflect.Kind{reflect.Int, reflect.Int, reflect.Slice}, kinds)
+
+	var plain listener
+	err = yaml.Unmarshal([]byte("port: 80\n"), &plain)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: unknown validator \"port\" for field port in type yaml_test.listener")
+}
+
+// scannedID implements sql.Scanner, accepting strings and integers.
+type scannedID struct {
+	ID     int64
+	Source string
+}
+
+func (s *scannedID) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		s.ID, s.Source = v, "int"
+	case string:
+		id, err := strconv.ParseInt(strings.TrimPrefix(v, "id-"), 10, 64)
+		if err != nil {
+			return err
+		}
+		s.ID, s.Source = id, "string"
+	default:
+		return fmt.Errorf("cannot scan %T", src)
+	}
+	return nil
+}
+
+func TestDecoderSetUseSQLScanner(t *testing.T) {
+	type config struct {
+		A scannedID
+		B scannedID
+		C *scannedID
+		D sql.NullInt64
+		E sql.NullString
+	}
+	data := "a: 42\nb: id-7\nc: 3\nd: 5\ne: ~\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetUseSQLScanner(true)
+	var c config
+	require.NoError(t, dec.Decode(&c))
+	require.Equal(t, config{
+		A: scannedID{42, "int"},
+		B: scannedID{7, "string"},
+		C: &scannedID{3, "int"},
+		D: sql.NullInt64{Int64: 5, Valid: true},
+	}, c)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: 1.5\n"))
+	dec.SetUseSQLScanner(true)
+	require.EqualError(t, dec.Decode(&c), "cannot scan float64")
+
+	// Without the option the scalars cannot be decoded into the structs.
+	require.Error(t, yaml.Unmarshal([]byte(data), &c))
+}
+
+func TestDecoderSetLeadingZeroAsString(t *testing.T) {
+	data := "zip: 08540\nid: 007\nneg: -007\nzero: 0\nhalf: 0.5\nhex: 0x1F\ntagged: !!int 010\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetLeadingZeroAsString(true)
+	var v map[string]interface{}
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{
+		"zip":    "08540",
+		"id":     "007",
+		"neg":    "-007",
+		"zero":   0,
+		"half":   0.5,
+		"hex":    31,
+		"tagged": 8,
+	}, v)
+
+	dec = yaml.NewDecoder(strings.NewReader("id: 007\n"))
+	dec.SetLeadingZeroAsString(true)
+	var n struct{ ID int }
+	require.Error(t, dec.Decode(&n))
+
+	// Without the option the scalars are numbers.
+	v = nil
+	require.NoError(t, yaml.Unmarshal([]byte("zip: 08540\nid: 007\n"), &v))
+	require.Equal(t, map[string]interface{}{"zip": 8540.0, "id": 7}, v)
+}
+
+func TestDecoderSetRequireExplicitAmbiguous(t *testing.T) {
+	decode := func(data string, v interface{}) error {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetRequireExplicitAmbiguous(true)
+		return dec.Decode(v)
+	}
+
+	var v map[string]interface{}
+	err := decode("date: 2015-01-01\nanswer: yes\nname: x\n", &v)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n"+
+		"  line 1: ambiguous plain scalar `2015-01-01` may be a timestamp or a string: add an explicit tag or quotes\n"+
+		"  line 2: ambiguous plain scalar `yes` may be a bool or a string: add an explicit tag or quotes")
+
+	// Explicit tags and quotes settle the type.
+	v = nil
+	require.NoError(t, decode("a: !!timestamp 2015-01-01\nb: '2015-01-01'\nc: \"yes\"\nd: !!str On\ne: true\nf: 2015\n", &v))
+	require.Equal(t, map[string]interface{}{
+		"a": time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+		"b": "2015-01-01",
+		"c": "yes",
+		"d": "On",
+		"e": true,
+		"f": 2015,
+	}, v)
+
+	// So do typed values.
+	var typed struct {
+		Date   time.Time
+		Name   string
+		Answer bool
+	}
+	require.NoError(t, decode("date: 2015-01-01\nname: 2015-01-01\nanswer: yes\n", &typed))
+	require.Equal(t, "2015-01-01", typed.Name)
+	require.True(t, typed.Answer)
+
+	// Without the option the scalars are decoded as usual.
+	v = nil
+	require.NoError(t, yaml.Unmarshal([]byte("date: 2015-01-01\nanswer: yes\n"), &v))
+	require.Equal(t, map[string]interface{}{"date": time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), "answer": "yes"}, v)
+}
+
+func TestDecoderSetCaseInsensitiveFields(t *testing.T) {
+	type config struct {
+		MaxRetries int
+		Lower      string `yaml:"id"`
+		Upper      string `yaml:"ID"`
+	}
+	decode := func(data string, known bool) (config, error) {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetCaseInsensitiveFields(true)
+		dec.KnownFields(known)
+		var c config
+		err := dec.Decode(&c)
+		return c, err
+	}
+	for _, key := range []string{"MaxRetries", "maxretries", "MAXRETRIES", "maxRetries"} {
+		c, err := decode(key+": 3\n", true)
+		require.NoError(t, err)
+		require.Equal(t, 3, c.MaxRetries, key)
+	}
+
+	// Exact matches take priority, and other keys match the first field.
+	c, err := decode("ID: upper\nid: lower\n", true)
+	require.NoError(t, err)
+	require.Equal(t, config{Lower: "lower", Upper: "upper"}, c)
+	c, err = decode("Id: first\n", true)
+	require.NoError(t, err)
+	require.Equal(t, config{Lower: "first"}, c)
+
+	_, err = decode("max_retries: 3\n", true)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: field max_retries not found in type yaml_test.config")
+	c, err = decode("max_retries: 3\n", false)
+	require.NoError(t, err)
+	require.Equal(t, config{}, c)
+
+	// Without the option keys must match exactly.
+	dec := yaml.NewDecoder(strings.NewReader("MaxRetries: 3\n"))
+	dec.KnownFields(true)
+	require.Error(t, dec.Decode(&c))
+}
+
+func TestDecoderSetPromoteEmbeddedPointers(t *testing.T) {
+	type config struct {
+		*EmbeddedB
+		*EmbeddedC
+		A int
+		D string
+	}
+	decode := func(data string, promote bool) (config, error) {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetPromoteEmbeddedPointers(promote)
+		dec.KnownFields(true)
+		var c config
+		err := dec.Decode(&c)
+		return c, err
+	}
+
+	c, err := decode("a: 1\nb: 2\n", true)
+	require.NoError(t, err)
+	require.Equal(t, config{EmbeddedB: &EmbeddedB{B: 2}, A: 1}, c)
+
+	// Pointers are left nil when none of their fields is present.
+	c, err = decode("a: 1\n", true)
+	require.NoError(t, err)
+	require.Equal(t, config{A: 1}, c)
+
+	// Outer fields take priority, and keys of several embedded pointers
+	// are not promoted.
+	c, err = decode("d: x\n", true)
+	require.NoError(t, err)
+	require.Equal(t, config{D: "x"}, c)
+	_, err = decode("c: 3\n", true)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: field c not found in type yaml_test.config")
+
+	// The embedded fields keep their own key.
+	c, err = decode("embeddedb: {c: 3}\n", true)
+	require.NoError(t, err)
+	require.Equal(t, config{EmbeddedB: &EmbeddedB{C: 3}}, c)
+
+	// Promoted fields are duplicates like the others.
+	_, err = decode("b: 1\nb: 2\n", true)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 2: mapping key \"b\" already defined at line 1")
+
+	_, err = decode("a: 1\nb: 2\n", false)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 2: field b not found in type yaml_test.config")
+
+	// Types embedding each other are promoted from once.
+	dec := yaml.NewDecoder(strings.NewReader("a: 1\nb: 2\n"))
+	dec.SetPromoteEmbeddedPointers(true)
+	var cycle EmbeddedCycleA
+	require.NoError(t, dec.Decode(&cycle))
+	require.Equal(t, EmbeddedCycleA{EmbeddedCycleB: &EmbeddedCycleB{B: 2}, A: 1}, cycle)
+
+	// Without the option they are handled as any other field.
+	cycle = EmbeddedCycleA{}
+	require.NoError(t, yaml.Unmarshal([]byte("a: 1\nembeddedcycleb: {b: 2}\n"), &cycle))
+	require.Equal(t, EmbeddedCycleA{EmbeddedCycleB: &EmbeddedCycleB{B: 2}, A: 1}, cycle)
+	out, err := yaml.Marshal(cycle)
+	require.NoError(t, err)
+	require.Equal(t, "embeddedcycleb:\n    embeddedcyclea: null\n    b: 2\na: 1\n", string(out))
+}
+
+func TestUnmarshalExplicitKeys(t *testing.T) {
+	for _, data := range []string{
+		"? a\n: 1\n? b\n: 2",
+		"a: 1\n? b\n: 2\n",
+		"? a # key\n: 1 # value\n# between\n? b\n\n: 2\n",
+		"?   a\n:   1\n?\tb\n:\t2\n",
+		"?\n  a\n:\n  1\n? \"b\"\n: 2\n",
+		"? >-\n  a\n: 1\n? b\n: 2\n",
+		"{? a : 1, ? b : 2}",
+	} {
+		var m map[string]int
+		require.NoError(t, yaml.Unmarshal([]byte(data), &m), data)
+		require.Equal(t, map[string]int{"a": 1, "b": 2}, m, data)
+	}
+
+	var v struct{ A, B int }
+	require.NoError(t, yaml.Unmarshal([]byte("? a\n: 1\n? b\n: 2"), &v))
+	require.Equal(t, struct{ A, B int }{1, 2}, v)
+
+	// A tab cannot separate the indicator from a compact block collection.
+	var i interface{}
+	require.Error(t, yaml.Unmarshal([]byte("?\t- a\n"), &i))
+	require.Error(t, yaml.Unmarshal([]byte("? a\n:\t- 1\n"), &i))
+}
+
+func TestUnmarshalSurrogatePairs(t *testing.T) {
+	for data, want := range map[string]string{
+		`"\uD83D\uDE00"`:           "\U0001F600",
+		`"a\uD83D\uDE00b"`:         "a\U0001F600b",
+		`"\ud83d\ude00\u00e9"`:     "\U0001F600\u00e9",
+		`"\uDBFF\uDFFF"`:           "\U0010FFFF",
+		`"\U0001F600\uD800\uDC00"`: "\U0001F600\U00010000",
+	} {
+		var v string
+		require.NoError(t, yaml.Unmarshal([]byte(data), &v), data)
+		require.Equal(t, want, v, data)
+	}
+
+	for _, data := range []string{
+		`"\uD83D"`,
+		`"\uD83D x"`,
+		`"\uD83D\uD83D"`,
+		`"\uD83D\uDE0"`,
+		`"\uDE00\uD83D"`,
+		`"\U0000D83D\uDE00"`,
+	} {
+		var v string
+		require.EqualError(t, yaml.Unmarshal([]byte(data), &v), "yaml: found invalid Unicode character escape code", data)
+	}
+}
+
+func TestUnmarshalInlineInterface(t *testing.T) {
+	type service struct {
+		Name string
+		Port int
+		Rest interface{} `yaml:",inline"`
+	}
+	data := "name: web\nport: 80\nreplicas: 3\nlabels: {tier: front}\n"
+	var s service
+	require.NoError(t, yaml.Unmarshal([]byte(data), &s))
+	require.Equal(t, service{
+		Name: "web",
+		Port: 80,
+		Rest: map[string]interface{}{"replicas": 3, "labels": map[string]interface{}{"tier": "front"}},
+	}, s)
+
+	out, err := yaml.Marshal(&s)
+	require.NoError(t, err)
+	require.Equal(t, "name: web\nport: 80\nlabels:\n    tier: front\nreplicas: 3\n", string(out))
+
+	// Without other keys the field is left nil.
+	s = service{}
+	require.NoError(t, yaml.Unmarshal([]byte("name: web\n"), &s))
+	require.Equal(t, service{Name: "web"}, s)
+
+	// The other keys are not unknown to KnownFields, and merged keys are
+	// collected as well.
+	dec := yaml.NewDecoder(strings.NewReader("base: &b {x: 1}\nname: web\n<<: *b\n"))
+	dec.KnownFields(true)
+	s = service{}
+	require.NoError(t, dec.Decode(&s))
+	require.Equal(t, service{Name: "web", Rest: map[string]interface{}{"base": map[string]interface{}{"x": 1}, "x": 1}}, s)
+
+	var invalid struct {
+		Rest fmt.Stringer `yaml:",inline"`
+	}
+	require.PanicsWithError(t, "option ,inline needs an empty interface in struct struct { Rest fmt.Stringer \"yaml:\\\",inline\\\"\" }", func() {
+		_ = yaml.Unmarshal([]byte("a: 1\n"), &invalid)
+	})
+}
+
+func TestUnmarshalAll(t *testing.T) {
+	var scalars []string
+	require.NoError(t, yaml.UnmarshalAll([]byte("a\n---\nb\n---\nc\n"), &scalars))
+	require.Equal(t, []string{"a", "b", "c"}, scalars)
+
+	var maps []map[string]int
+	require.NoError(t, yaml.UnmarshalAll([]byte("a: 1\n---\nb: 2\nc: 3\n"), &maps))
+	require.Equal(t, []map[string]int{{"a": 1}, {"b": 2, "c": 3}}, maps)
+
+	// Documents are appended to the existing elements.
+	require.NoError(t, yaml.UnmarshalAll([]byte("d: 4\n"), &maps))
+	require.Equal(t, []map[string]int{{"a": 1}, {"b": 2, "c": 3}, {"d": 4}}, maps)
+
+	// An empty stream leaves the slice untouched.
+	var empty []string
+	require.NoError(t, yaml.UnmarshalAll(nil, &empty))
+	require.Nil(t, empty)
+
+	// Type errors from every document are reported once the stream is read.
+	var ints []int
+	err := yaml.UnmarshalAll([]byte("1\n---\na\n---\n3\n---\nb\n"), &ints)
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 3: cannot unmarshal !!str `a` into int\n  line 7: cannot unmarshal !!str `b` into int")
+	require.Equal(t, []int{1, 0, 3, 0}, ints)
+
+	require.EqualError(t, yaml.UnmarshalAll([]byte("a\n"), &scalars[0]), "yaml: UnmarshalAll needs a non-nil pointer to a slice, got *string")
+	require.EqualError(t, yaml.UnmarshalAll([]byte("a\n"), scalars), "yaml: UnmarshalAll needs a non-nil pointer to a slice, got []string")
+
+	err = yaml.UnmarshalAll([]byte("a\n---\n[b\n"), &scalars)
+	require.Error(t, err)
+}
+
+func TestDecoderSetAcceptedVersions(t *testing.T) {
+	decode := func(data string, versions ...[2]int) (map[string]int, error) {
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		if versions != nil {
+			dec.SetAcceptedVersions(versions...)
+		}
+		var got map[string]int
+		err := dec.Decode(&got)
+		return got, err
+	}
+	accepted := [][2]int{{1, 1}, {1, 2}}
+
+	for _, data := range []string{"%YAML 1.1\n---\na: 1\n", "%YAML 1.2\n---\na: 1\n", "a: 1\n"} {
+		got, err := decode(data, accepted...)
+		require.NoError(t, err, data)
+		require.Equal(t, map[string]int{"a": 1}, got)
+	}
+
+	_, err := decode("%YAML 1.3\n---\na: 1\n", accepted...)
+	require.EqualError(t, err, "yaml: found unsupported YAML version 1.3")
+
+	_, err = decode("%YAML 1.2\n---\na: 1\n")
+	require.EqualError(t, err, "yaml: found incompatible YAML document")
+
+	_, err = decode("%YAML 1.1\n---\na: 1\n", [2]int{1, 2})
+	require.EqualError(t, err, "yaml: found unsupported YAML version 1.1")
+}
+
+func TestDecoderDecodeTypedMap(t *testing.T) {
+	type httpPlugin struct {
+		Port  int
+		Hosts []string
+	}
+	type filePlugin struct {
+		Path string
+		Mode int
+	}
+	data := "http:\n  port: 8080\n  hosts: [a, b]\nfile:\n  path: /tmp/out\n  mode: 0644\nother: [1, 2]\n"
+	types := map[string]reflect.Type{
+		"http": reflect.TypeOf(httpPlugin{}),
+		"file": reflect.TypeOf(&filePlugin{}),
+	}
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &node))
+
+	dec := yaml.NewDecoder(strings.NewReader(""))
+	out := make(map[string]interface{})
+	err := dec.DecodeTypedMap(&node, func(key string) reflect.Type { return types[key] }, out)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"http":  httpPlugin{Port: 8080, Hosts: []string{"a", "b"}},
+		"file":  &filePlugin{Path: "/tmp/out", Mode: 0644},
+		"other": []interface{}{1, 2},
+	}, out)
+
+	// The decoder options apply.
+	dec.KnownFields(true)
+	err = dec.DecodeTypedMap(&node, func(key string) reflect.Type {
+		if key == "http" {
+			return reflect.TypeOf(filePlugin{})
+		}
+		return types[key]
+	}, make(map[string]interface{}))
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 2: field port not found in type yaml_test.filePlugin\n  line 3: field hosts not found in type yaml_test.filePlugin")
+
+	require.NoError(t, yaml.Unmarshal([]byte("[1, 2]"), &node))
+	err = dec.DecodeTypedMap(&node, func(string) reflect.Type { return nil }, make(map[string]interface{}))
+	require.EqualError(t, err, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into map[string]interface {}")
+
+	// Merge keys are applied, and the keys of the mapping take precedence.
+	data = "defaults: &d {port: 80, hosts: [x]}\nextra: &e {port: 81, path: /e}\nplugins:\n  http:\n    <<: [*d, *e]\n    hosts: [a]\n  <<: [{file: {path: /m}}, {file: {path: /n}, other: 1}]\n"
+	require.NoError(t, yaml.Unmarshal([]byte(data), &node))
+	dec = yaml.NewDecoder(strings.NewReader(""))
+	out = make(map[string]interface{})
+	err = dec.DecodeTypedMap(node.Content[0].Content[5], func(key string) reflect.Type { return types[key] }, out)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"http":  httpPlugin{Port: 80, Hosts: []string{"a"}},
+		"file":  &filePlugin{Path: "/m"},
+		"other": 1,
+	}, out)
+
+	err = dec.DecodeTypedMap(nil, func(string) reflect.Type { return nil }, make(map[string]interface{}))
+	require.EqualError(t, err, "yaml: DecodeTypedMap needs a non-nil node")
+	err = dec.DecodeTypedMap(&yaml.Node{Kind: yaml.AliasNode, Value: "x"}, func(string) reflect.Type { return nil }, make(map[string]interface{}))
+	require.EqualError(t, err, "yaml: unknown anchor 'x' referenced")
+}
+
+func TestDecoderNullMakesNil(t *testing.T) {
+	type lists struct {
+		S  []int
+		M  map[string]int
+		P  *[]int
+		SS [][]int
+	}
+	prefilled := func() lists {
+		return lists{S: []int{1}, M: map[string]int{"x": 1}, P: &[]int{1}, SS: [][]int{{1}}}
+	}
+	tests := []struct {
+		data string
+		mode yaml.NullMode
+		want lists
+	}{
+		{data: "s:\nm: ~\np: null\nss: [~]\n", want: lists{SS: [][]int{nil}}},
+		{data: "s:\nm: ~\np: null\nss: [~]\n", mode: yaml.NullMakesEmpty, want: lists{S: []int{}, M: map[string]int{}, SS: [][]int{{}}}},
+		{data: "s: []\nm: {}\np: []\nss: [[]]\n", want: lists{S: []int{}, M: map[string]int{"x": 1}, P: &[]int{}, SS: [][]int{{}}}},
+		{data: "s: []\nm: {}\np: []\nss: [[]]\n", mode: yaml.NullMakesEmpty, want: lists{S: []int{}, M: map[string]int{"x": 1}, P: &[]int{}, SS: [][]int{{}}}},
+		{data: "{}", mode: yaml.NullMakesEmpty, want: prefilled()},
+	}
+	for _, test := range tests {
+		got := prefilled()
+		dec := yaml.NewDecoder(strings.NewReader(test.data))
+		dec.SetNullMode(test.mode)
+		require.NoError(t, dec.Decode(&got))
+		require.Equal(t, test.want, got, test.data)
+		require.Equal(t, test.want.S == nil, got.S == nil, test.data)
+		require.Equal(t, test.want.M == nil, got.M == nil, test.data)
+		require.Equal(t, test.want.SS[0] == nil, got.SS[0] == nil, test.data)
+	}
+
+	var fresh lists
+	require.NoError(t, yaml.Unmarshal([]byte("s: []\nm: {}\n"), &fresh))
+	require.NotNil(t, fresh.S)
+	require.NotNil(t, fresh.M)
+}
+
+func TestDecoderSetNullMode(t *testing.T) {
+	type lists struct {
+		S []int
+		M map[string]int
+		P *[]int
+	}
+	prefilled := func() lists {
+		return lists{S: []int{1}, M: map[string]int{"x": 1}, P: &[]int{1}}
+	}
+	tests := []struct {
+		mode yaml.NullMode
+		want lists
+	}{
+		{yaml.NullMakesNil, lists{}},
+		{yaml.NullMakesEmpty, lists{S: []int{}, M: map[string]int{}}},
+		{yaml.NullKeepsValue, lists{S: []int{1}, M: map[string]int{"x": 1}}},
+	}
+	for _, test := range tests {
+		got := prefilled()
+		dec := yaml.NewDecoder(strings.NewReader("s:\nm: ~\np: null\n"))
+		dec.SetNullMode(test.mode)
+		require.NoError(t, dec.Decode(&got))
+		require.Equal(t, test.want, got)
+		require.Equal(t, test.want.S == nil, got.S == nil)
+		require.Equal(t, test.want.M == nil, got.M == nil)
+	}
+
+	// Empty collections are decoded the same in all modes.
+	got := prefilled()
+	dec := yaml.NewDecoder(strings.NewReader("s: []\nm: {}\n"))
+	dec.SetNullMode(yaml.NullKeepsValue)
+	require.NoError(t, dec.Decode(&got))
+	require.Equal(t, lists{S: []int{}, M: map[string]int{"x": 1}, P: &[]int{1}}, got)
+}
+
+func TestDecoderSetExactFloatToInt(t *testing.T) {
+	type ints struct {
+		I   int
+		I8  int8
+		U   uint
+		I64 int64
+	}
+	tests := []struct {
+		data  string
+		want  ints
+		error string
+	}{
+		{data: "i: 1e3\nu: 1000.0\ni8: -1.28e2", want: ints{I: 1000, U: 1000, I8: -128}},
+		{data: "i64: -9.223372036854775808e18", want: ints{I64: math.MinInt64}},
+		{
+			data:  "i: 1.5e0",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `1.5e0` into int",
+		},
+		{
+			data:  "u: -1e3",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `-1e3` into uint",
+		},
+		{
+			data:  "i8: 1.28e2",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `1.28e2` into int8",
+		},
+		{
+			data:  "i64: 9.223372036854775808e18",
+			error: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `9.22337...` into int64",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			var got ints
+			dec := yaml.NewDecoder(strings.NewReader(test.data))
+			dec.SetExactFloatToInt(true)
+			err := dec.Decode(&got)
+			if test.error != "" {
+				require.EqualError(t, err, test.error)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.want, got)
+		})
+	}
+
+	var lax ints
+	require.NoError(t, yaml.Unmarshal([]byte("i: 1.5e0"), &lax))
+	require.Equal(t, 1, lax.I)
+}
+
+type wrappedTimestamp struct {
+	time.Time
+}
+
+type definedTimestamp time.Time
+
+func TestDecoderSetTimestampType(t *testing.T) {
+	data := "a: 2001-12-14\nb: !!timestamp 2001-12-14t21:59:43.10-05:00\nc: '2001-12-14'\nd: [2002-12-14]\n"
+	want := time.Date(2001, 12, 14, 0, 0, 0, 0, time.UTC)
+
+	var v map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &v))
+	require.Equal(t, want, v["a"])
+
+	v = nil
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetTimestampType(reflect.TypeOf(wrappedTimestamp{}))
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, wrappedTimestamp{want}, v["a"])
+	require.IsType(t, wrappedTimestamp{}, v["b"])
+	require.True(t, v["b"].(wrappedTimestamp).Equal(time.Date(2001, 12, 15, 2, 59, 43, 1e8, time.UTC)))
+	require.Equal(t, "2001-12-14", v["c"])
+	require.Equal(t, []interface{}{wrappedTimestamp{time.Date(2002, 12, 14, 0, 0, 0, 0, time.UTC)}}, v["d"])
+
+	var s struct{ A time.Time }
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetTimestampType(reflect.TypeOf(definedTimestamp{}))
+	require.NoError(t, dec.Decode(&s))
+	require.Equal(t, want, s.A)
+
+	v = nil
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetTimestampType(reflect.TypeOf(definedTimestamp{}))
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, definedTimestamp(want), v["a"])
+
+	require.Panics(t, func() { dec.SetTimestampType(reflect.TypeOf("")) })
+}
+
+func TestDecoderSetRejectTabs(t *testing.T) {
+	tests := []struct {
+		data  string
+		error string
+	}{
+		{data: "a: [1,\t2]\n", error: "yaml: line 1: found a tab character"},
+		{data: "a: 1\nb: \"x\ty\"\n", error: "yaml: line 2: found a tab character"},
+		{data: "a: 1 # a\tcomment\n", error: "yaml: line 1: found a tab character"},
+		{data: "a: 1\n---\nb: |\n  x\ty\n", error: "yaml: line 4: found a tab character"},
+	}
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+			var v interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(test.data), &v))
+
+			dec := yaml.NewDecoder(strings.NewReader(test.data))
+			dec.SetRejectTabs(true)
+			var err error
+			for err == nil {
+				err = dec.Decode(&v)
+			}
+			require.EqualError(t, err, test.error)
+		})
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader("a: [1, 2]\n"))
+	dec.SetRejectTabs(true)
+	var v interface{}
+	require.NoError(t, dec.Decode(&v))
+
+	var syntaxErr *yaml.SyntaxError
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\nbb: 'x\ty'\n"))
+	dec.SetRejectTabs(true)
+	require.True(t, errors.As(dec.Decode(&v), &syntaxErr))
+	require.Equal(t, 2, syntaxErr.Line)
+	require.Equal(t, 7, syntaxErr.Column)
+}
+
+func TestDecoderSetErrorRecovery(t *testing.T) {
+	type service struct {
+		Name    string
+		Port    int
+		Env     map[string]string
+		Command []string
+	}
+	data := "name: web\nport 80\nenv:\n  a: 1\n  b 2\n  c: 3\ncommand: [run]\n---\nname: db\n"
+
+	var v service
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	require.EqualError(t, dec.Decode(&v), "yaml: line 2: could not find expected ':'")
+
+	v = service{}
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetErrorRecovery(true)
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, service{Name: "web", Env: map[string]string{"a": "1", "c": "3"}, Command: []string{"run"}}, v)
+	require.Equal(t, []string{"line 2: could not find expected ':'", "line 5: could not find expected ':'"}, dec.Warnings())
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, "db", v.Name)
+	require.Len(t, dec.Warnings(), 2)
+
+	dec = yaml.NewDecoder(strings.NewReader("name: web\nport: [80\n"))
+	dec.SetErrorRecovery(true)
+	require.Error(t, dec.Decode(&v))
+	require.Nil(t, dec.Warnings())
+}
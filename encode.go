@@ -34,9 +34,31 @@ import (
 )
 
 type Encoder struct {
-	emitter emitter.Emitter
-	flow    bool
-	started bool
+	emitter       emitter.Emitter
+	flow          bool
+	started       bool
+	headerComment string
+	scalarOnly    bool
+	explicitEnd   bool
+	explicitNull  bool
+	encodeErrors  bool
+	durationInt   bool
+	maxCommentLen int
+	maxDepth      int
+	depth         int
+	sortKeysDepth int
+
+	preserveInlineOrder bool
+	typeTags            map[reflect.Type]string
+	version             *yamlh.VersionDirective
+	encodeSets          bool
+	emptyAsNull         bool
+	minimalTags         bool
+	keyStyle            yamlh.YamlScalarStyle
+	inKey               bool
+	blankLines          int
+
+	boolTrue, boolFalse string
 }
 
 // Encode writes the YAML encoding of v to the stream.
@@ -47,20 +69,36 @@ type Encoder struct {
 // See the documentation for Marshal for details about the conversion of Go
 // values to YAML.
 func (e *Encoder) Encode(v interface{}) error {
-	if !e.started {
-		err := e.emitter.Emit(streamStartEvent(), false)
+	if e.scalarOnly {
+		n, err := scalarNode(v)
 		if err != nil {
 			return err
 		}
-		e.started = true
+		v = n
+	}
+
+	header, err := e.startStream()
+	if err != nil {
+		return err
 	}
 
 	node, ok := v.(*Node)
 	if ok && node.Kind == DocumentNode {
+		if header != "" {
+			doc := *node
+			doc.HeadComment = header
+			if node.HeadComment != "" {
+				doc.HeadComment += "\n\n" + node.HeadComment
+			}
+			node = &doc
+		}
 		return e.encodeNode(node, "")
 	}
 
-	err := e.emitter.Emit(documentStartEvent(), false)
+	event := documentStartEvent()
+	event.Head_comment = []byte(header)
+	event.Version_directive = e.takeVersion()
+	err = e.emitter.Emit(event, false)
 	if err != nil {
 		return err
 	}
@@ -68,7 +106,158 @@ func (e *Encoder) Encode(v interface{}) error {
 	if err != nil {
 		return err
 	}
-	return e.emitter.Emit(documentEndEvent(), false)
+	return e.emitter.Emit(e.documentEndEvent(), false)
+}
+
+// EncodeStream writes a document holding a sequence whose items are
+// received from ch until it is closed. Items are encoded as they arrive
+// rather than being collected first, and a channel closed without sending
+// any item produces an empty sequence.
+//
+// See the documentation for Marshal for details about the conversion of Go
+// values to YAML.
+func (e *Encoder) EncodeStream(ch <-chan interface{}) error {
+	header, err := e.startStream()
+	if err != nil {
+		return err
+	}
+
+	event := documentStartEvent()
+	event.Head_comment = []byte(header)
+	event.Version_directive = e.takeVersion()
+	err = e.emitter.Emit(event, false)
+	if err != nil {
+		return err
+	}
+	err = e.emitter.Emit(sequenceStartEvent(nil, nil, true, yamlh.BLOCK_SEQUENCE_STYLE), false)
+	if err != nil {
+		return err
+	}
+	for v := range ch {
+		err = e.marshal("", v)
+		if err != nil {
+			return err
+		}
+	}
+	err = e.emitter.Emit(sequenceEndEvent(), false)
+	if err != nil {
+		return err
+	}
+	return e.emitter.Emit(e.documentEndEvent(), false)
+}
+
+// startStream emits the stream start event before the first document and
+// returns the header comment that document should carry.
+func (e *Encoder) startStream() (string, error) {
+	if e.started {
+		return "", nil
+	}
+	err := e.emitter.Emit(streamStartEvent(), false)
+	if err != nil {
+		return "", err
+	}
+	e.started = true
+	return e.headerComment, nil
+}
+
+// SetVersionDirective makes the encoder write a %YAML directive declaring
+// version major.minor, such as "%YAML 1.1", before the next document it
+// encodes. Only the versions the decoder can read, 1.1 and 1.2, may be
+// given, and documents declaring 1.2 must be decoded with the versions
+// accepted set with Decoder.SetAcceptedVersions.
+func (e *Encoder) SetVersionDirective(major, minor int) {
+	if major != 1 || minor != 1 && minor != 2 {
+		panic(fmt.Sprintf("yaml: cannot write a %%YAML directive for version %d.%d", major, minor))
+	}
+	e.version = &yamlh.VersionDirective{Major: int8(major), Minor: int8(minor)}
+}
+
+// SetMinimalTags makes the encoder drop the tags of nodes that are
+// explicitly tagged, as decoded from "!!int 1", when the node resolves to
+// the same tag without it, so "!!int 1", "!!bool true" and "!!map {a: 1}"
+// are written as "1", "true" and "{a: 1}". Tags that are not explicit
+// are always dropped in that case. A quoted, literal or folded style
+// already implies a string, so !!str is dropped from such nodes, while
+// plain !!str scalars that would resolve to another type, as in
+// "!!str 123", are written quoted instead. Other tags on quoted nodes, and
+// tags that change how the value resolves, as in "!!float 1", are kept.
+func (e *Encoder) SetMinimalTags(enable bool) {
+	e.minimalTags = enable
+}
+
+// SetEmptyAsNull makes the encoder write empty Go maps, slices and arrays
+// that are the values of mapping entries as empty nulls, as in "key:",
+// rather than as "key: {}" or "key: []". They decode back as nil maps and
+// slices, or as empty ones with Decoder.SetNullMode(NullMakesEmpty). Types
+// that implement Marshaler or encoding.TextMarshaler are written as usual,
+// as are empty collections in sequences.
+func (e *Encoder) SetEmptyAsNull(enable bool) {
+	e.emptyAsNull = enable
+}
+
+// SetBoolStyle makes the encoder write Go bool values as trueStr and
+// falseStr, such as "yes" and "no" or "on" and "off", rather than as
+// "true" and "false", for consumers that expect YAML 1.1 booleans. Both
+// must be booleans of the right value in YAML 1.2 or in YAML 1.1, or
+// SetBoolStyle panics. The YAML 1.1 forms are decoded as booleans into Go
+// bool values only, and as strings into interfaces.
+func (e *Encoder) SetBoolStyle(trueStr, falseStr string) {
+	for _, b := range []struct {
+		s    string
+		want bool
+	}{{trueStr, true}, {falseStr, false}} {
+		value, ok := oldBool(b.s)
+		if tag, resolved, err := resolve.Resolve("", b.s); err == nil && tag == resolve.BoolTag {
+			value, ok = resolved.(bool), true
+		}
+		if !ok || value != b.want {
+			panic(fmt.Sprintf("yaml: cannot write %t as %q", b.want, b.s))
+		}
+	}
+	e.boolTrue, e.boolFalse = trueStr, falseStr
+}
+
+// SetKeyStyle sets the style of the mapping keys the encoder must quote,
+// such as the string "123", which would otherwise be read back as an
+// integer. style is DoubleQuotedStyle, the default, or SingleQuotedStyle;
+// SetKeyStyle panics with any other style. Values, and keys given an
+// explicit style in a Node, are not affected, and keys that cannot be
+// single-quoted, such as those with control characters, are still written
+// double-quoted.
+func (e *Encoder) SetKeyStyle(style Style) {
+	switch style {
+	case DoubleQuotedStyle:
+		e.keyStyle = yamlh.DOUBLE_QUOTED_SCALAR_STYLE
+	case SingleQuotedStyle:
+		e.keyStyle = yamlh.SINGLE_QUOTED_SCALAR_STYLE
+	default:
+		panic(fmt.Sprintf("yaml: cannot quote keys with style %d", style))
+	}
+}
+
+// encodeKey runs f to encode a mapping key, so that the scalar it writes
+// is quoted as set with SetKeyStyle when it must be.
+func (e *Encoder) encodeKey(f func() error) error {
+	e.inKey = true
+	err := f()
+	e.inKey = false
+	return err
+}
+
+// quotedStyle returns the style of a scalar that must be quoted.
+func (e *Encoder) quotedStyle() yamlh.YamlScalarStyle {
+	if e.inKey && e.keyStyle == yamlh.SINGLE_QUOTED_SCALAR_STYLE {
+		return yamlh.SINGLE_QUOTED_SCALAR_STYLE
+	}
+	return yamlh.DOUBLE_QUOTED_SCALAR_STYLE
+}
+
+// takeVersion returns the version directive set with SetVersionDirective
+// for the document being started, if any, and clears it.
+func (e *Encoder) takeVersion() *yamlh.VersionDirective {
+	v := e.version
+	e.version = nil
+	return v
 }
 
 // SetIndent changes the used indentation used when encoding.
@@ -76,6 +265,211 @@ func (e *Encoder) SetIndent(spaces int) {
 	e.emitter.SetIndent(spaces)
 }
 
+// SetSequenceIndent changes the indentation of block sequences that are the
+// value of a mapping key, independently of SetIndent. The default follows
+// SetIndent, and 0 aligns the "-" indicators with the key.
+func (e *Encoder) SetSequenceIndent(spaces int) {
+	e.emitter.SetSequenceIndent(spaces)
+}
+
+// SetBlockScalarIndent adds spaces to the indentation of the content of
+// literal and folded scalars, on top of the indentation set by SetIndent.
+// The total is written as an explicit indentation indicator, such as "|6",
+// so the scalar decodes to the same value. As the indicator is a single
+// digit, encoding fails if the total exceeds 9.
+func (e *Encoder) SetBlockScalarIndent(spaces int) {
+	e.emitter.SetBlockScalarIndent(spaces)
+}
+
+// SetFlowWrap makes the encoder write the items of flow collections over
+// several lines, indented within the collection, when they would otherwise
+// make a line longer than columns characters. 0, the default, writes flow
+// collections on a single line.
+func (e *Encoder) SetFlowWrap(columns int) {
+	e.emitter.SetFlowWidth(columns)
+}
+
+// SetCompactFlow makes the encoder omit the spaces after "," and ":" in flow
+// collections, writing {"a":1,"b":[2,3]} rather than {a: 1, b: [2, 3]}. As
+// YAML requires a space after the ":" following a plain key, keys that are
+// decoded as strings are double-quoted, and the space is kept after other
+// plain keys, such as numbers, so the output decodes to the same values.
+func (e *Encoder) SetCompactFlow(enable bool) {
+	e.emitter.SetCompactFlow(enable)
+}
+
+// SetMaxInlineCommentLen makes the encoder write node line comments longer
+// than n characters as the last lines of the head comment of the node, so
+// they do not make the line they trail too long. The line comment of a
+// mapping value is written above its key. A line comment spanning several
+// lines is moved as it is, each of its lines becoming a line of the head
+// comment. A value of 0 or less, the default, keeps all line comments inline.
+func (e *Encoder) SetMaxInlineCommentLen(n int) {
+	e.maxCommentLen = n
+}
+
+// Chomping selects the chomping indicator the encoder writes for literal and
+// folded block scalars, which tells how their trailing line breaks are kept.
+type Chomping int
+
+const (
+	// ClipChomping writes no indicator when the value ends with a single
+	// line break, "|-" when it ends without one and "|+" when it ends with
+	// more than one. This is the default.
+	ClipChomping Chomping = iota
+
+	// StripChomping writes "|-" for all block scalars. As the strip
+	// indicator drops all trailing line breaks, values ending with line
+	// breaks are written double-quoted instead.
+	StripChomping
+
+	// KeepChomping writes "|+" for all values ending with line breaks.
+	// Values ending without one are written with "|-".
+	KeepChomping
+)
+
+// SetBlockChomping sets the chomping indicator used for block scalars.
+// The indicator is only used when it preserves the value exactly, so the
+// encoded value always decodes back to the original string.
+func (e *Encoder) SetBlockChomping(mode Chomping) {
+	e.emitter.SetKeepChomping(mode == KeepChomping)
+	e.emitter.SetStripChomping(mode == StripChomping)
+}
+
+// SetExplicitDocumentEnd makes the encoder terminate every document with
+// the "..." document end marker. Document foot comments are written before
+// the marker.
+func (e *Encoder) SetExplicitDocumentEnd(enable bool) {
+	e.explicitEnd = enable
+}
+
+// documentEndEvent returns the event ending a document, which is explicit
+// when requested with SetExplicitDocumentEnd.
+func (e *Encoder) documentEndEvent() *yamlh.Event {
+	event := documentEndEvent()
+	event.Implicit = !e.explicitEnd
+	return event
+}
+
+// SetExplicitNull makes the encoder write null for nodes holding an
+// implicit null as an empty plain scalar, as produced when decoding "a:"
+// into a Node, so they are written as "a: null" rather than "a:".
+func (e *Encoder) SetExplicitNull(enable bool) {
+	e.explicitNull = enable
+}
+
+// SetDurationString sets whether time.Duration values are written with
+// their String method, such as "1h30m0s", which is the default and is how
+// they are decoded. When disabled, they are written as their integer number
+// of nanoseconds, which the decoder does not accept for a time.Duration.
+func (e *Encoder) SetDurationString(enable bool) {
+	e.durationInt = !enable
+}
+
+// SetEncodeErrors makes the encoder write values implementing the error
+// interface as their Error message, rather than as the struct or other value
+// holding the error. Marshaler and encoding.TextMarshaler implementations
+// still take precedence.
+func (e *Encoder) SetEncodeErrors(enable bool) {
+	e.encodeErrors = enable
+}
+
+// SetMaxDepth limits the nesting of sequences and mappings, so a Node tree or
+// a Go value that is too deep, or that contains itself, fails with an error
+// instead of exhausting the stack. A value of 0 or less, the default, means
+// no limit.
+func (e *Encoder) SetMaxDepth(n int) {
+	if n < 0 {
+		n = 0
+	}
+	e.maxDepth = n
+}
+
+// SetSortKeysBelowDepth makes the encoder sort the keys of the mappings
+// nested deeper than depth, where the top-level mapping or sequence is at
+// depth 1, so 1 keeps the order of the top-level mapping and sorts all of the
+// others, and 0 sorts all mappings. Sorting applies to struct fields and Node
+// mappings, which are otherwise encoded in their own order. The keys of Go
+// maps are always sorted. A negative depth, the default, sorts nothing.
+func (e *Encoder) SetSortKeysBelowDepth(depth int) {
+	e.sortKeysDepth = 0
+	if depth >= 0 {
+		e.sortKeysDepth = depth + 1
+	}
+}
+
+// SetPreserveInlineOrder makes the encoder write each item of an ,inline
+// InlineMap right after the struct field it followed when it was decoded,
+// so the keys are interleaved with the struct fields as in the original
+// document. Items that were not decoded, or whose field is omitted, follow
+// the fields. SetSortKeysBelowDepth takes precedence.
+func (e *Encoder) SetPreserveInlineOrder(enable bool) {
+	e.preserveInlineOrder = enable
+}
+
+// SetEncodeSets makes the encoder write Go maps whose values are empty
+// structs, such as map[string]struct{}, as !!set mappings whose values are
+// empty nulls, rather than as mappings of empty mappings. As with all Go
+// maps, the keys are sorted so the output is the same on every run.
+func (e *Encoder) SetEncodeSets(enable bool) {
+	e.encodeSets = enable
+}
+
+// isSetType returns whether t is a map type whose values are empty structs.
+func isSetType(t reflect.Type) bool {
+	elem := t.Elem()
+	return elem.Kind() == reflect.Struct && elem.NumField() == 0
+}
+
+// RegisterTypeTag makes the encoder write values of type t with tag, such as
+// "!uuid". Values are written as usual, so a type implementing
+// encoding.TextMarshaler is written as a tagged string of its text. Types
+// that implement fmt.Stringer but neither Marshaler nor
+// encoding.TextMarshaler are written as a tagged string of their String
+// method. An empty tag removes the
+// registration. See Decoder.SetTypeHints for decoding such values back into
+// t when the target is an interface.
+func (e *Encoder) RegisterTypeTag(t reflect.Type, tag string) {
+	if tag == "" {
+		delete(e.typeTags, t)
+		return
+	}
+	if e.typeTags == nil {
+		e.typeTags = make(map[reflect.Type]string)
+	}
+	e.typeTags[t] = tag
+}
+
+// SetScalarOnly makes Encode fail when v is not encoded as a single scalar,
+// such as a mapping or a sequence. Scalars are written as for any other
+// document, quoted only when they would otherwise be read back as a
+// different value, such as the string "true".
+func (e *Encoder) SetScalarOnly(enable bool) {
+	e.scalarOnly = enable
+}
+
+// scalarNode returns v as a scalar node, or an error if it does not encode
+// to a scalar.
+func scalarNode(v interface{}) (*Node, error) {
+	var n Node
+	err := n.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	if n.Kind != ScalarNode {
+		return nil, fmt.Errorf("yaml: cannot encode %s when only scalars are allowed", n.kindString())
+	}
+	return &n, nil
+}
+
+// SetHeaderComment sets a comment that is written once at the top of the
+// stream, before the content of the first document. Lines that do not
+// already start with "#" are prefixed with "# ". It has no effect once the
+// first document has been encoded.
+func (e *Encoder) SetHeaderComment(s string) {
+	e.headerComment = s
+}
+
 func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{
 		emitter: *emitter.New(w),
@@ -88,9 +482,40 @@ func (e *Encoder) Close() error {
 	return e.emitter.Emit(streamEndEvent(), true)
 }
 
+// typeTag returns the tag registered with RegisterTypeTag for the type of v,
+// or of the value v points to.
+func (e *Encoder) typeTag(v interface{}) (string, bool) {
+	if len(e.typeTags) == 0 {
+		return "", false
+	}
+	for t := reflect.TypeOf(v); t != nil; t = t.Elem() {
+		if tag, ok := e.typeTags[t]; ok {
+			return tag, true
+		}
+		if t.Kind() != reflect.Ptr {
+			break
+		}
+	}
+	return "", false
+}
+
 func (e *Encoder) marshal(tag string, v interface{}) error {
+	if t, ok := e.typeTag(v); ok {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return e.encodeNil()
+		}
+		tag = resolve.LongTag(t)
+		switch value := v.(type) {
+		case Marshaler, encoding.TextMarshaler:
+		case fmt.Stringer:
+			return e.encodeString(tag, value.String())
+		}
+	}
 	switch value := v.(type) {
 	case *Node:
+		if value == nil {
+			return e.encodeNil()
+		}
 		return e.encodeNode(value, tag)
 	case Node:
 		return e.encodeNode(&value, tag)
@@ -99,6 +524,9 @@ func (e *Encoder) marshal(tag string, v interface{}) error {
 	case *time.Time:
 		return e.encodeTime(tag, *value)
 	case time.Duration:
+		if e.durationInt {
+			return e.encodeInt(tag, int64(value))
+		}
 		return e.encodeString(tag, value.String())
 	case Marshaler:
 		rv := reflect.ValueOf(v)
@@ -120,6 +548,14 @@ func (e *Encoder) marshal(tag string, v interface{}) error {
 			return err
 		}
 		return e.encodeString(tag, string(text))
+	case error:
+		if e.encodeErrors {
+			rv := reflect.ValueOf(v)
+			if rv.Kind() == reflect.Ptr && rv.IsNil() {
+				return e.encodeNil()
+			}
+			return e.encodeString(tag, value.Error())
+		}
 	case int, int8, int16, int32, int64:
 		return e.encodeInt(tag, value)
 	case uint, uint8, uint16, uint32, uint64:
@@ -171,15 +607,28 @@ func (e *Encoder) marshalReflectValue(tag string, rv reflect.Value) error {
 }
 
 func (e *Encoder) encodeMap(tag string, in reflect.Value) error {
+	set := e.encodeSets && tag == "" && isSetType(in.Type())
+	if set {
+		tag = resolve.LongTag(resolve.SetTag)
+	}
 	return e.encodeMapping(tag, func() error {
 		keys := sorter.KeyList(in.MapKeys())
 		sort.Sort(keys)
 		for _, k := range keys {
-			err := e.marshal("", k.Interface())
+			err := e.encodeKey(func() error {
+				return e.marshal("", k.Interface())
+			})
 			if err != nil {
 				return err
 			}
-			err = e.marshal("", in.MapIndex(k).Interface())
+			if set {
+				err = e.emitScalar("", "", "", yamlh.PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err = e.marshalValue(in.MapIndex(k))
 			if err != nil {
 				return err
 			}
@@ -210,7 +659,24 @@ func (e *Encoder) encodeStruct(tag string, in reflect.Value) error {
 	if err != nil {
 		panic(err)
 	}
+	if tag == "" && sinfo.TagField != -1 {
+		if t := in.Field(sinfo.TagField).String(); resolve.ShortTag(t) != resolve.MapTag {
+			tag = resolve.LongTag(t)
+		}
+	}
 	return e.encodeMapping(tag, func() error {
+		type entry struct {
+			key   reflect.Value
+			value reflect.Value
+			flow  bool
+			base  int
+
+			// The position of an InlineMap item, see InlineItem.
+			inline bool
+			after  string
+			placed bool
+		}
+		var entries []entry
 		for _, info := range sinfo.FieldsList {
 			var value reflect.Value
 			if info.Inline == nil {
@@ -224,43 +690,174 @@ func (e *Encoder) encodeStruct(tag string, in reflect.Value) error {
 			if info.OmitEmpty && isZero(value) {
 				continue
 			}
-			err = e.marshal("", reflect.ValueOf(info.Key).Interface())
-			if err != nil {
-				return err
-			}
-			e.flow = info.Flow
-			err = e.marshal("", value.Interface())
-			if err != nil {
-				return err
+			if info.Repeated {
+				for i := 0; i < value.Len(); i++ {
+					entries = append(entries, entry{key: reflect.ValueOf(info.Key), value: value.Index(i), flow: info.Flow})
+				}
+				continue
 			}
+			entries = append(entries, entry{key: reflect.ValueOf(info.Key), value: value, flow: info.Flow, base: info.Base})
 		}
 		if sinfo.InlineMap >= 0 {
 			m := in.Field(sinfo.InlineMap)
-			if m.Len() > 0 {
-				e.flow = false
+			if m.Kind() == reflect.Interface && !m.IsNil() {
+				m = m.Elem()
+				if m.Kind() != reflect.Map || m.Type().Key().Kind() != reflect.String {
+					panic(fmt.Sprintf("cannot inline %s: the ,inline interface{} of %s must hold a map with string keys", m.Type(), in.Type()))
+				}
+			}
+			if m.Type() == inlineMapType {
+				items := m.Interface().(InlineMap)
+				for i, item := range items {
+					if _, found := sinfo.FieldsMap[item.Key]; found {
+						panic(fmt.Sprintf("cannot have key %q in inlined map: conflicts with struct field", item.Key))
+					}
+					entries = append(entries, entry{
+						key:    reflect.ValueOf(item.Key),
+						value:  reflect.ValueOf(&items[i].Value).Elem(),
+						inline: true,
+						after:  item.after,
+						placed: item.placed,
+					})
+				}
+			}
+			if m.Kind() == reflect.Map && m.Len() > 0 {
 				keys := sorter.KeyList(m.MapKeys())
 				sort.Sort(keys)
 				for _, k := range keys {
 					if _, found := sinfo.FieldsMap[k.String()]; found {
 						panic(fmt.Sprintf("cannot have key %q in inlined map: conflicts with struct field", k.String()))
 					}
-					err = e.marshal("", k.Interface())
-					if err != nil {
-						return err
-					}
-					e.flow = false
-					err = e.marshal("", m.MapIndex(k).Interface())
-					if err != nil {
-						return err
-					}
+					entries = append(entries, entry{key: k, value: m.MapIndex(k)})
 				}
 			}
 		}
+		if e.preserveInlineOrder {
+			fields := make(map[string]bool)
+			for _, entry := range entries {
+				if !entry.inline {
+					fields[entry.key.String()] = true
+				}
+			}
+			var first, rest []entry
+			after := make(map[string][]entry)
+			for _, entry := range entries {
+				switch {
+				case !entry.inline:
+				case !entry.placed || entry.after != "" && !fields[entry.after]:
+					rest = append(rest, entry)
+				case entry.after == "":
+					first = append(first, entry)
+				default:
+					after[entry.after] = append(after[entry.after], entry)
+				}
+			}
+			placed := first
+			for _, entry := range entries {
+				if !entry.inline {
+					key := entry.key.String()
+					placed = append(placed, entry)
+					placed = append(placed, after[key]...)
+					delete(after, key)
+				}
+			}
+			entries = append(placed, rest...)
+		}
+		if e.sortKeys() {
+			sort.SliceStable(entries, func(i, j int) bool {
+				return sorter.KeyList{entries[i].key, entries[j].key}.Less(0, 1)
+			})
+		}
+		for _, entry := range entries {
+			err = e.encodeKey(func() error {
+				return e.marshal("", entry.key.Interface())
+			})
+			if err != nil {
+				return err
+			}
+			e.flow = entry.flow
+			if entry.base != 0 {
+				err = e.encodeIntBase(entry.value, entry.base)
+			} else {
+				err = e.marshalValue(entry.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
 
+// marshalValue encodes the value of a mapping entry, writing empty maps,
+// slices and arrays as empty nulls when requested with SetEmptyAsNull.
+func (e *Encoder) marshalValue(v reflect.Value) error {
+	if e.emptyAsNull && isEmptyCollection(v) {
+		e.flow = false
+		return e.emitScalar("", "", "", yamlh.PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+	}
+	return e.marshal("", v.Interface())
+}
+
+// isEmptyCollection returns whether v holds, possibly through interfaces
+// and pointers, an empty map, slice or array that is encoded as a mapping
+// or sequence.
+func isEmptyCollection(v reflect.Value) bool {
+	for {
+		if v.CanInterface() {
+			switch v.Interface().(type) {
+			case Marshaler, encoding.TextMarshaler:
+				return false
+			}
+		}
+		if v.Kind() != reflect.Interface && v.Kind() != reflect.Ptr {
+			break
+		}
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	}
+	return false
+}
+
+// enter increases the nesting depth when starting a sequence or mapping,
+// failing when it exceeds maxDepth. node is the Node being encoded, or nil
+// for Go values.
+func (e *Encoder) enter(node *Node) error {
+	e.inKey = false
+	e.depth++
+	if e.maxDepth > 0 && e.depth > e.maxDepth {
+		e.depth--
+		if node == nil || node.Line == 0 {
+			return fmt.Errorf("yaml: node exceeds the maximum depth of %d", e.maxDepth)
+		}
+		return fmt.Errorf("yaml: line %d, column %d: node exceeds the maximum depth of %d", node.Line, node.Column, e.maxDepth)
+	}
+	return nil
+}
+
+// leave decreases the nesting depth at the end of a sequence or mapping.
+func (e *Encoder) leave() {
+	e.depth--
+}
+
+// sortKeys returns whether the keys of the mapping being encoded must be
+// sorted, as requested with SetSortKeysBelowDepth.
+func (e *Encoder) sortKeys() bool {
+	return e.sortKeysDepth > 0 && e.depth >= e.sortKeysDepth
+}
+
 func (e *Encoder) encodeMapping(tag string, f func() error) error {
+	err := e.enter(nil)
+	if err != nil {
+		return err
+	}
+	defer e.leave()
 	implicit := tag == ""
 	style := yamlh.BLOCK_MAPPING_STYLE
 	if e.flow {
@@ -268,7 +865,7 @@ func (e *Encoder) encodeMapping(tag string, f func() error) error {
 		style = yamlh.FLOW_MAPPING_STYLE
 	}
 	event := mappingStartEvent(nil, []byte(tag), implicit, style)
-	err := e.emitter.Emit(event, true)
+	err = e.emitter.Emit(event, true)
 	if err != nil {
 		return err
 	}
@@ -280,13 +877,18 @@ func (e *Encoder) encodeMapping(tag string, f func() error) error {
 }
 
 func (e *Encoder) encodeSlice(tag string, in reflect.Value) error {
+	err := e.enter(nil)
+	if err != nil {
+		return err
+	}
+	defer e.leave()
 	implicit := tag == ""
 	style := yamlh.BLOCK_SEQUENCE_STYLE
 	if e.flow {
 		e.flow = false
 		style = yamlh.FLOW_SEQUENCE_STYLE
 	}
-	err := e.emitter.Emit(sequenceStartEvent(nil, []byte(tag), implicit, style), false)
+	err = e.emitter.Emit(sequenceStartEvent(nil, []byte(tag), implicit, style), false)
 	if err != nil {
 		return err
 	}
@@ -328,13 +930,20 @@ var base60float = regexp.MustCompile(`^[-+]?\d[0-9_]*(?::[0-5]?\d)+(?:\.[0-9_]*)
 // rendered as quotes strings so that the marshalled output valid for YAML 1.1
 // parsing.
 func isOldBool(s string) (result bool) {
+	_, ok := oldBool(s)
+	return ok
+}
+
+// oldBool returns the value of s in the bool notation defined in YAML 1.1,
+// and whether s is in that notation.
+func oldBool(s string) (value, ok bool) {
 	switch s {
-	case "y", "Y", "yes", "Yes", "YES", "on", "On", "ON",
-		"n", "N", "no", "No", "NO", "off", "Off", "OFF":
-		return true
-	default:
-		return false
+	case "y", "Y", "yes", "Yes", "YES", "on", "On", "ON":
+		return true, true
+	case "n", "N", "no", "No", "NO", "off", "Off", "OFF":
+		return false, true
 	}
+	return false, false
 }
 
 func (e *Encoder) encodeString(tag, s string) error {
@@ -375,17 +984,21 @@ func (e *Encoder) encodeString(tag, s string) error {
 	case canUsePlain:
 		style = yamlh.PLAIN_SCALAR_STYLE
 	default:
-		style = yamlh.DOUBLE_QUOTED_SCALAR_STYLE
+		style = e.quotedStyle()
 	}
 	return e.emitScalar(s, "", tag, style, nil, nil, nil, nil)
 }
 
 func (e *Encoder) encodeBool(tag string, v bool) error {
-	var s string
+	s := "false"
 	if v {
 		s = "true"
-	} else {
-		s = "false"
+	}
+	if e.boolTrue != "" {
+		s = e.boolFalse
+		if v {
+			s = e.boolTrue
+		}
 	}
 	return e.emitScalar(s, "", tag, yamlh.PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
 }
@@ -426,6 +1039,36 @@ func (e *Encoder) encideUint(tag string, v interface{}) error {
 	return e.emitScalar(s, "", tag, yamlh.PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
 }
 
+// encodeIntBase writes the integer in rv, or the integer it points to, in
+// base 16, 8 or 2 with the matching prefix.
+func (e *Encoder) encodeIntBase(rv reflect.Value, base int) error {
+	// Custom marshalling takes precedence over the base.
+	switch rv.Interface().(type) {
+	case Marshaler, encoding.TextMarshaler:
+		return e.marshalValue(rv)
+	}
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return e.encodeNil()
+		}
+		rv = rv.Elem()
+	}
+	prefix := map[int]string{16: "0x", 8: "0o", 2: "0b"}[base]
+	var s string
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(rv.Int(), base)
+	default:
+		s = strconv.FormatUint(rv.Uint(), base)
+	}
+	if strings.HasPrefix(s, "-") {
+		s = "-" + prefix + s[1:]
+	} else {
+		s = prefix + s
+	}
+	return e.emitScalar(s, "", "", yamlh.PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+}
+
 func (e *Encoder) encodeTime(tag string, v time.Time) error {
 	s := v.Format(time.RFC3339Nano)
 	return e.emitScalar(s, "", tag, yamlh.PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
@@ -459,25 +1102,44 @@ func (e *Encoder) emitScalar(value, anchor, tag string, style yamlh.YamlScalarSt
 	event.Line_comment = line
 	event.Foot_comment = foot
 	event.Tail_comment = tail
+	event.Blank_lines = e.takeBlankLines()
 	return e.emitter.Emit(event, false)
 }
 
+// takeBlankLines returns the BlankLinesBefore of the mapping key being
+// encoded, for its first event, and 0 for any other event.
+func (e *Encoder) takeBlankLines() int {
+	n := e.blankLines
+	e.blankLines = 0
+	return n
+}
+
 func (e *Encoder) encodeNode(node *Node, tail string) error {
 	// Zero nodes behave as nil.
 	if node.Kind == 0 && node.IsZero() {
 		return e.encodeNil()
 	}
 
-	// If the tag was not explicitly requested, and dropping it won't change the
-	// implicit tag of the value, don't include it in the presentation.
+	if node.Kind == SequenceNode || node.Kind == MappingNode {
+		err := e.enter(node)
+		if err != nil {
+			return err
+		}
+		defer e.leave()
+	}
+
+	// If the tag was not explicitly requested, or SetMinimalTags is enabled,
+	// and dropping it won't change the implicit tag of the value, don't
+	// include it in the presentation.
 	tag := node.Tag
 	shortTag := resolve.ShortTag(tag)
 	var forceQuoting bool
-	if tag != "" && node.Style&TaggedStyle == 0 {
+	if tag != "" && (node.Style&TaggedStyle == 0 || e.minimalTags) {
 		if node.Kind == ScalarNode {
-			if shortTag == resolve.StrTag && node.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0 {
+			quoted := node.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0
+			if shortTag == resolve.StrTag && quoted {
 				tag = ""
-			} else {
+			} else if !quoted || !e.minimalTags {
 				rtag, _, err := resolve.Resolve("", node.Value)
 				if err != nil {
 					return err
@@ -522,6 +1184,7 @@ func (e *Encoder) encodeNode(node *Node, tail string) error {
 func (e *Encoder) encodeDocumentNode(node *Node) error {
 	event := documentStartEvent()
 	event.Head_comment = []byte(node.HeadComment)
+	event.Version_directive = e.takeVersion()
 	err := e.emitter.Emit(event, false)
 	if err != nil {
 		return err
@@ -532,7 +1195,7 @@ func (e *Encoder) encodeDocumentNode(node *Node) error {
 			return err
 		}
 	}
-	event = documentEndEvent()
+	event = e.documentEndEvent()
 	event.Foot_comment = []byte(node.FootComment)
 	return e.emitter.Emit(event, false)
 }
@@ -544,18 +1207,26 @@ func (e *Encoder) encodeSequenceNode(node *Node, tag string) error {
 	}
 	event := sequenceStartEvent([]byte(node.Anchor), []byte(resolve.LongTag(tag)), tag == "", style)
 	event.Head_comment = []byte(node.HeadComment)
+	event.Blank_lines = e.takeBlankLines()
+	lineComment := []byte(node.LineComment)
+	if style == yamlh.BLOCK_SEQUENCE_STYLE {
+		// The line comment of a block sequence goes on the line it starts,
+		// after the "-" or ":" indicator it follows.
+		event.Line_comment, lineComment = lineComment, nil
+	}
 	err := e.emitter.Emit(event, false)
 	if err != nil {
 		return err
 	}
 	for _, n := range node.Content {
+		n, _ = e.moveLongLineComment(n, n)
 		err = e.encodeNode(n, "")
 		if err != nil {
 			return err
 		}
 	}
 	event = sequenceEndEvent()
-	event.Line_comment = []byte(node.LineComment)
+	event.Line_comment = lineComment
 	event.Foot_comment = []byte(node.FootComment)
 	return e.emitter.Emit(event, false)
 }
@@ -568,6 +1239,11 @@ func (e *Encoder) encodeMappingNode(node *Node, tail, tag string) error {
 	event := mappingStartEvent([]byte(node.Anchor), []byte(resolve.LongTag(tag)), tag == "", style)
 	event.Tail_comment = []byte(tail)
 	event.Head_comment = []byte(node.HeadComment)
+	event.Blank_lines = e.takeBlankLines()
+	lineComment := []byte(node.LineComment)
+	if style == yamlh.BLOCK_MAPPING_STYLE {
+		event.Line_comment, lineComment = lineComment, nil
+	}
 	err := e.emitter.Emit(event, false)
 	if err != nil {
 		return err
@@ -577,22 +1253,30 @@ func (e *Encoder) encodeMappingNode(node *Node, tail, tag string) error {
 	// since the value for each key may be a nested structure and the foot needs to be
 	// processed only the entirety of the value is streamed. The last tail is processed
 	// with the mapping end event.
+	content := node.Content
+	if e.sortKeys() {
+		content = sortedPairs(content)
+	}
 	var tl string
-	for i := 0; i+1 < len(node.Content); i += 2 {
-		k := node.Content[i]
+	for i := 0; i+1 < len(content); i += 2 {
+		k := content[i]
 		foot := k.FootComment
 		if foot != "" {
 			kopy := *k
 			kopy.FootComment = ""
 			k = &kopy
 		}
-		err = e.encodeNode(k, tl)
+		k, _ = e.moveLongLineComment(k, k)
+		k, v := e.moveLongLineComment(k, content[i+1])
+		e.blankLines = k.BlankLinesBefore
+		err = e.encodeKey(func() error {
+			return e.encodeNode(k, tl)
+		})
 		if err != nil {
 			return err
 		}
 		tl = foot
 
-		v := node.Content[i+1]
 		err = e.encodeNode(v, "")
 		if err != nil {
 			return err
@@ -601,16 +1285,56 @@ func (e *Encoder) encodeMappingNode(node *Node, tail, tag string) error {
 
 	event = mappingEndEvent()
 	event.Tail_comment = []byte(tl)
-	event.Line_comment = []byte(node.LineComment)
+	event.Line_comment = lineComment
 	event.Foot_comment = []byte(node.FootComment)
 	return e.emitter.Emit(event, false)
 }
 
+// moveLongLineComment moves the line comment of n to the head comment of
+// head when it is longer than the limit set with SetMaxInlineCommentLen. The
+// nodes are copied rather than modified, and returned in the same order.
+func (e *Encoder) moveLongLineComment(head, n *Node) (*Node, *Node) {
+	if e.maxCommentLen <= 0 || utf8.RuneCountInString(n.LineComment) <= e.maxCommentLen {
+		return head, n
+	}
+	h := *head
+	if h.HeadComment != "" {
+		h.HeadComment += "\n"
+	}
+	h.HeadComment += n.LineComment
+	if n == head {
+		h.LineComment = ""
+		return &h, &h
+	}
+	v := *n
+	v.LineComment = ""
+	return &h, &v
+}
+
+// sortedPairs returns a copy of the key and value pairs of a mapping node's
+// content sorted by key, in the order Go map keys are encoded in.
+func sortedPairs(content []*Node) []*Node {
+	pairs := make([][2]*Node, 0, len(content)/2)
+	for i := 0; i+1 < len(content); i += 2 {
+		pairs = append(pairs, [2]*Node{content[i], content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		a, b := pairs[i][0], pairs[j][0]
+		return sorter.KeyList{reflect.ValueOf(a.Value), reflect.ValueOf(b.Value)}.Less(0, 1)
+	})
+	sorted := make([]*Node, 0, len(content))
+	for _, pair := range pairs {
+		sorted = append(sorted, pair[0], pair[1])
+	}
+	return sorted
+}
+
 func (e *Encoder) encodeAliasNode(node *Node) error {
 	event := aliasEvent([]byte(node.Value))
 	event.Head_comment = []byte(node.HeadComment)
 	event.Line_comment = []byte(node.LineComment)
 	event.Foot_comment = []byte(node.FootComment)
+	event.Blank_lines = e.takeBlankLines()
 	return e.emitter.Emit(event, false)
 }
 
@@ -642,7 +1366,10 @@ func (e *Encoder) encodeScalarNode(node *Node, tail, shortTag, tag string, force
 	case strings.Contains(value, "\n"):
 		style = yamlh.LITERAL_SCALAR_STYLE
 	case forceQuoting:
-		style = yamlh.DOUBLE_QUOTED_SCALAR_STYLE
+		style = e.quotedStyle()
+	}
+	if e.explicitNull && value == "" && tag == "" && style == yamlh.PLAIN_SCALAR_STYLE {
+		value = "null"
 	}
 
 	return e.emitScalar(value, node.Anchor, tag, style, []byte(node.HeadComment), []byte(node.LineComment), []byte(node.FootComment), []byte(tail))
@@ -17,10 +17,13 @@ package yaml_test
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"math"
 	"net"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -371,6 +374,22 @@ var marshalTests = []struct {
 		data: "a: 1\nc: 3\nd: 4\n",
 	},
 
+	// Embedded struct pointers are not promoted.
+	{
+		value: &struct {
+			*EmbeddedB
+			A int
+		}{EmbeddedB: &EmbeddedB{B: 2}, A: 1},
+		data: "embeddedb:\n    b: 2\n    c: 0\na: 1\n",
+	},
+	{
+		value: &struct {
+			*EmbeddedB
+			A int
+		}{A: 1},
+		data: "embeddedb: null\na: 1\n",
+	},
+
 	// Map inlining
 	{
 		value: &struct {
@@ -591,6 +610,116 @@ func TestEncoderMultipleDocuments(t *testing.T) {
 	require.Equal(t, "a: b\n---\nc: d\n", buf.String())
 }
 
+func TestEncoderSetHeaderComment(t *testing.T) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetHeaderComment("generated file\n# do not edit")
+	err := enc.Encode(map[string]string{"a": "b"})
+	require.NoError(t, err)
+	err = enc.Encode(map[string]string{"c": "d"})
+	require.NoError(t, err)
+	err = enc.Close()
+	require.NoError(t, err)
+	require.Equal(t, "# generated file\n# do not edit\n\na: b\n---\nc: d\n", buf.String())
+
+	var node yaml.Node
+	err = yaml.Unmarshal([]byte("# doc comment\n\na: b\n"), &node)
+	require.NoError(t, err)
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.SetHeaderComment("header")
+	err = enc.Encode(&node)
+	require.NoError(t, err)
+	err = enc.Close()
+	require.NoError(t, err)
+	require.Equal(t, "# header\n\n# doc comment\n\na: b\n", buf.String())
+}
+
+func TestEncoderEncodeStream(t *testing.T) {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		ch <- 1
+		ch <- "two"
+		ch <- map[string]int{"three": 3}
+	}()
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	err := enc.EncodeStream(ch)
+	require.NoError(t, err)
+	ch = make(chan interface{})
+	close(ch)
+	err = enc.EncodeStream(ch)
+	require.NoError(t, err)
+	err = enc.Close()
+	require.NoError(t, err)
+	require.Equal(t, "- 1\n- two\n- three: 3\n---\n[]\n", buf.String())
+}
+
+func TestEncoderSetScalarOnly(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"foo", "foo\n"},
+		{"true", "\"true\"\n"},
+		{"null", "\"null\"\n"},
+		{"~", "\"~\"\n"},
+		{"", "\"\"\n"},
+		{"1.0", "\"1.0\"\n"},
+		{"0o17", "\"0o17\"\n"},
+		{"2001-12-14", "\"2001-12-14\"\n"},
+		{"a: b", "'a: b'\n"},
+		{"- a", "'- a'\n"},
+		{true, "true\n"},
+		{42, "42\n"},
+		{nil, "null\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetScalarOnly(true)
+		err := enc.Encode(test.value)
+		require.NoError(t, err)
+		err = enc.Close()
+		require.NoError(t, err)
+		require.Equal(t, test.want, buf.String(), "value: %#v", test.value)
+	}
+
+	enc := yaml.NewEncoder(&bytes.Buffer{})
+	enc.SetScalarOnly(true)
+	err := enc.Encode(map[string]int{"a": 1})
+	require.EqualError(t, err, "yaml: cannot encode mapping node when only scalars are allowed")
+	err = enc.Encode([]int{1})
+	require.EqualError(t, err, "yaml: cannot encode sequence node when only scalars are allowed")
+}
+
+func TestEncoderSetExplicitDocumentEnd(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte("c: d\n\n# foot\n"), &doc)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetExplicitDocumentEnd(true)
+	err = enc.Encode(map[string]string{"a": "b"})
+	require.NoError(t, err)
+	err = enc.Encode(&doc)
+	require.NoError(t, err)
+	err = enc.Close()
+	require.NoError(t, err)
+	want := "a: b\n...\n---\nc: d\n\n# foot\n...\n"
+	require.Equal(t, want, buf.String())
+
+	dec := yaml.NewDecoder(strings.NewReader(want))
+	var v map[string]string
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]string{"a": "b"}, v)
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]string{"a": "b", "c": "d"}, v)
+	require.Equal(t, io.EOF, dec.Decode(&v))
+}
+
 func TestEncoderWriteError(t *testing.T) {
 	enc := yaml.NewEncoder(errorWriter{})
 	err := enc.Encode(map[string]string{"a": "b"})
@@ -619,6 +748,12 @@ var marshalErrorTests = []struct {
 		B map[string]int ",inline"
 	}{A: 1, B: map[string]int{"a": 2}},
 	panic: `cannot have key "a" in inlined map: conflicts with struct field`,
+}, {
+	value: &struct {
+		A    int
+		Rest interface{} `yaml:",inline"`
+	}{A: 1, Rest: []int{2}},
+	panic: `cannot inline \[\]int: the ,inline interface\{\} of struct \{ A int; .* must hold a map with string keys`,
 }}
 
 func TestMarshalErrors(t *testing.T) {
@@ -723,6 +858,293 @@ func TestSetIndent(t *testing.T) {
 	require.Equal(t, "a:\n        b:\n                c: d\n", buf.String())
 }
 
+func TestSetSequenceIndent(t *testing.T) {
+	value := map[string]interface{}{
+		"a": []interface{}{1, map[string]interface{}{"b": []int{2}, "c": 3}},
+		"d": map[string]interface{}{"e": []int{4}},
+	}
+	tests := []struct {
+		indent int
+		want   string
+	}{
+		{0, "a:\n- 1\n- b:\n  - 2\n  c: 3\nd:\n  e:\n  - 4\n"},
+		{4, "a:\n    - 1\n    - b:\n          - 2\n      c: 3\nd:\n  e:\n      - 4\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		enc.SetSequenceIndent(test.indent)
+		err := enc.Encode(value)
+		require.NoError(t, err)
+		err = enc.Close()
+		require.NoError(t, err)
+		require.Equal(t, test.want, buf.String())
+	}
+	require.Panics(t, func() { yaml.NewEncoder(&bytes.Buffer{}).SetSequenceIndent(-1) })
+}
+
+func TestEncoderSetBlockChomping(t *testing.T) {
+	values := []string{"x\ny", "x\ny\n", "x\ny\n\n"}
+	tests := []struct {
+		mode yaml.Chomping
+		want []string
+	}{
+		{yaml.ClipChomping, []string{"a: |-\n    x\n    y\n", "a: |\n    x\n    y\n", "a: |+\n    x\n    y\n\n"}},
+		{yaml.StripChomping, []string{"a: |-\n    x\n    y\n", "a: \"x\\ny\\n\"\n", "a: \"x\\ny\\n\\n\"\n"}},
+		{yaml.KeepChomping, []string{"a: |-\n    x\n    y\n", "a: |+\n    x\n    y\n", "a: |+\n    x\n    y\n\n"}},
+	}
+	for _, test := range tests {
+		for i, value := range values {
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetBlockChomping(test.mode)
+			err := enc.Encode(map[string]string{"a": value})
+			require.NoError(t, err)
+			require.NoError(t, enc.Close())
+			require.Equal(t, test.want[i], buf.String())
+
+			var got map[string]string
+			err = yaml.Unmarshal(buf.Bytes(), &got)
+			require.NoError(t, err)
+			require.Equal(t, value, got["a"])
+		}
+	}
+}
+
+func TestEncoderSetFlowWrap(t *testing.T) {
+	type flowValue struct {
+		Items  []string          `yaml:"items,flow"`
+		Labels map[string]string `yaml:"labels,flow"`
+	}
+	v := flowValue{Labels: map[string]string{}}
+	for i := 0; i < 20; i++ {
+		v.Items = append(v.Items, fmt.Sprintf("item-%d", i))
+		v.Labels[fmt.Sprintf("k%02d", i)] = "'v'"
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetFlowWrap(40)
+	require.NoError(t, enc.Encode(v))
+	require.NoError(t, enc.Close())
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Greater(t, len(lines), 4)
+	for _, line := range lines {
+		require.LessOrEqual(t, len(line), 40, line)
+	}
+
+	var got flowValue
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, v, got)
+
+	out, err := yaml.Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(out), "\n"))
+	require.Panics(t, func() { yaml.NewEncoder(&bytes.Buffer{}).SetFlowWrap(-1) })
+}
+
+func TestEncoderSetCompactFlow(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{map[string]int{"a": 1, "b": 2}, `{"a":1,"b":2}` + "\n"},
+		{[]interface{}{"a", -1, []string{"b", "c"}}, "[a,-1,[b,c]]\n"},
+		{map[interface{}]interface{}{1: "x", "true": map[string]string{"y": "z"}, "k": []int{}}, `{1: x,"k":[],"true":{"y":z}}` + "\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetCompactFlow(true)
+		require.NoError(t, enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{flowNode(t, test.value)}}))
+		require.NoError(t, enc.Close())
+		require.Equal(t, test.want, buf.String())
+
+		var want, got interface{}
+		out, err := yaml.Marshal(test.value)
+		require.NoError(t, err)
+		require.NoError(t, yaml.Unmarshal(out, &want))
+		require.NoError(t, yaml.Unmarshal(buf.Bytes(), &got))
+		require.Equal(t, want, got)
+	}
+}
+
+// flowNode returns v encoded as a node with all its collections in the flow
+// style.
+func flowNode(t *testing.T, v interface{}) *yaml.Node {
+	t.Helper()
+	var n yaml.Node
+	require.NoError(t, n.Encode(v))
+	var setFlow func(n *yaml.Node)
+	setFlow = func(n *yaml.Node) {
+		if n.Kind == yaml.SequenceNode || n.Kind == yaml.MappingNode {
+			n.Style = yaml.FlowStyle
+		}
+		for _, c := range n.Content {
+			setFlow(c)
+		}
+	}
+	setFlow(&n)
+	return &n
+}
+
+func TestEncoderSetMaxInlineCommentLen(t *testing.T) {
+	data := "name: web # short\n" +
+		"# port\n" +
+		"port: 8080 # the port the service listens on, matching the balancer\n" +
+		"list:\n" +
+		"    - a # a long comment about the first item\n" +
+		"    - b # ok\n" +
+		"map: # a long comment about the mapping\n" +
+		"    x: 1\n"
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetMaxInlineCommentLen(20)
+	require.NoError(t, enc.Encode(&doc))
+	require.NoError(t, enc.Close())
+	want := "name: web # short\n" +
+		"# port\n" +
+		"# the port the service listens on, matching the balancer\n" +
+		"port: 8080\n" +
+		"list:\n" +
+		"    # a long comment about the first item\n" +
+		"    - a\n" +
+		"    - b # ok\n" +
+		"# a long comment about the mapping\n" +
+		"map:\n" +
+		"    x: 1\n"
+	require.Equal(t, want, buf.String())
+
+	out, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+	require.Equal(t, data, string(out))
+}
+
+func TestEncoderSetDurationString(t *testing.T) {
+	type timeouts struct {
+		Read  time.Duration
+		Write time.Duration
+		Idle  *time.Duration
+		Other interface{}
+	}
+	idle := 90 * time.Minute
+	v := timeouts{Read: 3 * time.Second, Write: 1500 * time.Microsecond, Idle: &idle, Other: -time.Hour}
+
+	out, err := yaml.Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, "read: 3s\nwrite: 1.5ms\nidle: 1h30m0s\nother: -1h0m0s\n", string(out))
+	var got timeouts
+	require.NoError(t, yaml.Unmarshal(out, &got))
+	require.Equal(t, v.Read, got.Read)
+	require.Equal(t, v.Write, got.Write)
+	require.Equal(t, v.Idle, got.Idle)
+	require.Equal(t, "-1h0m0s", got.Other)
+
+	for _, d := range []time.Duration{0, time.Nanosecond, 42 * time.Second, 25*time.Hour + time.Millisecond} {
+		out, err = yaml.Marshal(d)
+		require.NoError(t, err)
+		var got time.Duration
+		require.NoError(t, yaml.Unmarshal(out, &got))
+		require.Equal(t, d, got)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetDurationString(false)
+	require.NoError(t, enc.Encode(v))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "read: 3000000000\nwrite: 1500000\nidle: 5400000000000\nother: -3600000000000\n", buf.String())
+}
+
+func TestEncoderSetEncodeErrors(t *testing.T) {
+	type result struct {
+		Status string
+		Err    error `yaml:"err"`
+		Cause  error `yaml:"cause"`
+	}
+	v := result{Status: "failed", Err: fmt.Errorf("dial: %w", os.ErrDeadlineExceeded)}
+	for _, enable := range []bool{false, true} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetEncodeErrors(enable)
+		require.NoError(t, enc.Encode(v))
+		require.NoError(t, enc.Close())
+		want := "status: failed\nerr: {}\ncause: null\n"
+		if enable {
+			want = "status: failed\nerr: 'dial: i/o timeout'\ncause: null\n"
+		}
+		require.Equal(t, want, buf.String())
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetEncodeErrors(true)
+	require.NoError(t, enc.Encode(map[string]error{"a": strconv.ErrRange, "b": (*net.AddrError)(nil)}))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "a: value out of range\nb: null\n", buf.String())
+}
+
+func TestEncoderSetExplicitNull(t *testing.T) {
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte("ka:\n  kb:\n  kc: ~\n  kd: \"\"\n"), &node)
+	require.NoError(t, err)
+	for _, explicit := range []bool{false, true} {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetExplicitNull(explicit)
+		require.NoError(t, enc.Encode(&node))
+		require.NoError(t, enc.Close())
+		want := "ka:\n    kb:\n    kc: ~\n    kd: \"\"\n"
+		if explicit {
+			want = "ka:\n    kb: null\n    kc: ~\n    kd: \"\"\n"
+		}
+		require.Equal(t, want, buf.String())
+
+		var v map[string]map[string]interface{}
+		require.NoError(t, yaml.Unmarshal(buf.Bytes(), &v))
+		require.Equal(t, map[string]map[string]interface{}{"ka": {"kb": nil, "kc": nil, "kd": ""}}, v)
+	}
+}
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a:b", "a:b"},
+		{"yes", `"yes"`},
+		{"true", `"true"`},
+		{"null", `"null"`},
+		{"1.5", `"1.5"`},
+		{"- x", "'- x'"},
+		{"a: b", "'a: b'"},
+		{"x #y", "'x #y'"},
+		{"#x", "'#x'"},
+		{"@x", "'@x'"},
+		{"it's", "it's"},
+		{"'", "''''"},
+		{" lead", "' lead'"},
+		{"", `""`},
+		{"a\nb", `"a\nb"`},
+		{"a\u2028b", `"a\Lb"`},
+		{"\x01", `"\x01"`},
+		{"\xff", "!!binary /w=="},
+	}
+	for _, test := range tests {
+		got := yaml.QuoteString(test.in)
+		require.Equal(t, test.want, got, "input: %q", test.in)
+		var back struct{ V string }
+		err := yaml.Unmarshal([]byte("v: "+got), &back)
+		require.NoError(t, err)
+		require.Equal(t, test.in, back.V)
+	}
+}
+
 func TestSortedOutput(t *testing.T) {
 	order := []interface{}{
 		false,
@@ -801,3 +1223,557 @@ func TestSortedOutput(t *testing.T) {
 func newTime(t time.Time) *time.Time {
 	return &t
 }
+
+func TestEncoderSetSortKeysBelowDepth(t *testing.T) {
+	type config struct {
+		Name    string
+		Limits  map[string]int
+		Options struct {
+			Verbose bool
+			Debug   bool
+		}
+		Items []struct {
+			Z int
+			A int
+		}
+	}
+	var c config
+	c.Name = "app"
+	c.Limits = map[string]int{"memory": 2, "cpu": 1}
+	c.Options.Verbose = true
+	c.Items = append(c.Items, struct {
+		Z int
+		A int
+	}{Z: 1, A: 2})
+
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte("z: 1\na:\n  y: 2\n  b: 3\n"), &node))
+
+	tests := []struct {
+		depth      int
+		want, node string
+	}{
+		{
+			depth: -1,
+			want:  "name: app\nlimits:\n    cpu: 1\n    memory: 2\noptions:\n    verbose: true\n    debug: false\nitems:\n    - z: 1\n      a: 2\n",
+			node:  "z: 1\na:\n    y: 2\n    b: 3\n",
+		},
+		{
+			depth: 0,
+			want:  "items:\n    - a: 2\n      z: 1\nlimits:\n    cpu: 1\n    memory: 2\nname: app\noptions:\n    debug: false\n    verbose: true\n",
+			node:  "a:\n    b: 3\n    y: 2\nz: 1\n",
+		},
+		{
+			depth: 1,
+			want:  "name: app\nlimits:\n    cpu: 1\n    memory: 2\noptions:\n    debug: false\n    verbose: true\nitems:\n    - a: 2\n      z: 1\n",
+			node:  "z: 1\na:\n    b: 3\n    y: 2\n",
+		},
+		{
+			depth: 2,
+			want:  "name: app\nlimits:\n    cpu: 1\n    memory: 2\noptions:\n    verbose: true\n    debug: false\nitems:\n    - a: 2\n      z: 1\n",
+			node:  "z: 1\na:\n    y: 2\n    b: 3\n",
+		},
+	}
+	for _, test := range tests {
+		for _, v := range []interface{}{c, &node} {
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetSortKeysBelowDepth(test.depth)
+			require.NoError(t, enc.Encode(v))
+			require.NoError(t, enc.Close())
+			want := test.want
+			if v == &node {
+				want = test.node
+			}
+			require.Equal(t, want, buf.String(), "depth %d", test.depth)
+		}
+	}
+}
+
+func TestMarshalDiff(t *testing.T) {
+	type limits struct {
+		CPU    int
+		Memory int
+	}
+	type service struct {
+		Name   string
+		Limits limits
+		Tags   []string
+	}
+	base := service{Name: "app", Limits: limits{CPU: 1, Memory: 512}, Tags: []string{"a", "b"}}
+
+	modified := base
+	modified.Limits.Memory = 1024
+	out, err := yaml.MarshalDiff(base, modified)
+	require.NoError(t, err)
+	require.Equal(t, "limits:\n    memory: 1024\n", string(out))
+
+	modified = base
+	modified.Tags = []string{"a", "c"}
+	out, err = yaml.MarshalDiff(&base, &modified)
+	require.NoError(t, err)
+	require.Equal(t, "tags:\n    - a\n    - c\n", string(out))
+
+	out, err = yaml.MarshalDiff(base, base)
+	require.NoError(t, err)
+	require.Equal(t, "{}\n", string(out))
+
+	out, err = yaml.MarshalDiff(
+		map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2}},
+		map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2, "d": 3}, "e": 4},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "b:\n    d: 3\ne: 4\n", string(out))
+
+	var baseNode, modifiedNode yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte("a: [{x: 1, y: 0x2}]\nb: 1\n"), &baseNode))
+	require.NoError(t, yaml.Unmarshal([]byte("b: 2\na: [{y: 2, x: 1}]\n"), &modifiedNode))
+	out, err = yaml.MarshalDiff(&baseNode, &modifiedNode)
+	require.NoError(t, err)
+	require.Equal(t, "b: 2\n", string(out))
+}
+
+func TestEncoderSetBlockScalarIndent(t *testing.T) {
+	type doc struct {
+		Script string
+		Steps  []string
+	}
+	v := doc{
+		Script: "echo one\necho two\n",
+		Steps:  []string{"  indented\nline\n"},
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetBlockScalarIndent(2)
+	require.NoError(t, enc.Encode(v))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "script: |6\n      echo one\n      echo two\nsteps:\n    - |4\n          indented\n        line\n", buf.String())
+
+	var got doc
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, v, got)
+
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.SetBlockScalarIndent(6)
+	require.Error(t, enc.Encode(v))
+}
+
+func TestEncodeBlockScalarIndentIndicator(t *testing.T) {
+	// Without extra indentation the indicator of values starting with a
+	// space is still relative to the enclosing collection.
+	tests := []struct {
+		indent int
+		value  interface{}
+		want   string
+	}{
+		{2, []string{"  x\ny\n"}, "- |2\n    x\n  y\n"},
+		{3, []string{"  x\ny\n"}, "- |2\n    x\n  y\n"},
+		{4, []string{"  x\ny\n"}, "- |2\n    x\n  y\n"},
+		{4, map[string][]string{"a": {"  x\ny\n"}}, "a:\n    - |2\n        x\n      y\n"},
+		{4, map[string]string{"a": "  x\ny\n"}, "a: |4\n      x\n    y\n"},
+		{3, "  x\ny\n", "|3\n     x\n   y\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(test.indent)
+		require.NoError(t, enc.Encode(test.value))
+		require.NoError(t, enc.Close())
+		require.Equal(t, test.want, buf.String())
+
+		got := reflect.New(reflect.TypeOf(test.value))
+		require.NoError(t, yaml.Unmarshal(buf.Bytes(), got.Interface()))
+		require.Equal(t, test.value, got.Elem().Interface())
+	}
+}
+
+func TestEncoderSetPreserveInlineOrder(t *testing.T) {
+	type config struct {
+		Name  string
+		Port  int
+		Extra yaml.InlineMap `yaml:",inline"`
+	}
+	data := "zone: eu\nname: web\nregion: west\nport: 80\nalpha: 1\n"
+	var c config
+	require.NoError(t, yaml.Unmarshal([]byte(data), &c))
+	var keys []string
+	for _, item := range c.Extra {
+		keys = append(keys, item.Key)
+	}
+	require.Equal(t, []string{"zone", "region", "alpha"}, keys)
+	require.Equal(t, "west", c.Extra[1].Value)
+
+	out, err := yaml.Marshal(&c)
+	require.NoError(t, err)
+	require.Equal(t, "name: web\nport: 80\nzone: eu\nregion: west\nalpha: 1\n", string(out))
+
+	encode := func(v interface{}) string {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetPreserveInlineOrder(true)
+		require.NoError(t, enc.Encode(v))
+		require.NoError(t, enc.Close())
+		return buf.String()
+	}
+	require.Equal(t, data, encode(&c))
+
+	// Items added after decoding follow the others.
+	c.Extra = append(c.Extra, yaml.InlineItem{Key: "beta", Value: 2})
+	require.Equal(t, data+"beta: 2\n", encode(&c))
+
+	// Decoding again replaces the items.
+	require.NoError(t, yaml.Unmarshal([]byte("port: 1\nzone: us\n"), &c))
+	require.Len(t, c.Extra, 1)
+	require.Equal(t, "name: web\nport: 1\nzone: us\n", encode(&c))
+}
+
+type testUUID [4]byte
+
+func (u testUUID) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(u[:])), nil
+}
+
+func (u *testUUID) UnmarshalText(text []byte) error {
+	_, err := hex.Decode(u[:], text)
+	return err
+}
+
+type testColor int
+
+func (c testColor) String() string {
+	return [...]string{"red", "green"}[c]
+}
+
+type testLevel int
+
+func (l testLevel) String() string {
+	return fmt.Sprintf("level-%d", int(l))
+}
+
+func (l testLevel) MarshalYAML() (interface{}, error) {
+	return int(l), nil
+}
+
+func TestEncoderRegisterTypeTag(t *testing.T) {
+	type record struct {
+		ID    testUUID
+		Owner *testUUID
+		Any   interface{}
+		Color testColor
+	}
+	owner := testUUID{1, 2, 3, 4}
+	v := record{ID: testUUID{0xde, 0xad, 0xbe, 0xef}, Owner: &owner, Any: testUUID{5, 6, 7, 8}, Color: 1}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.RegisterTypeTag(reflect.TypeOf(testUUID{}), "!uuid")
+	enc.RegisterTypeTag(reflect.TypeOf(testColor(0)), "!color")
+	require.NoError(t, enc.Encode(v))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "id: !uuid deadbeef\nowner: !uuid 01020304\nany: !uuid 05060708\ncolor: !color green\n", buf.String())
+
+	var got struct {
+		ID    testUUID
+		Owner *testUUID
+		Any   interface{}
+	}
+	dec := yaml.NewDecoder(&buf)
+	dec.SetTypeHints(map[string]reflect.Type{"!uuid": reflect.TypeOf(testUUID{})})
+	require.NoError(t, dec.Decode(&got))
+	require.Equal(t, v.ID, got.ID)
+	require.Equal(t, v.Owner, got.Owner)
+	require.Equal(t, v.Any, got.Any)
+
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.RegisterTypeTag(reflect.TypeOf(testUUID{}), "!uuid")
+	enc.RegisterTypeTag(reflect.TypeOf(testUUID{}), "")
+	require.NoError(t, enc.Encode(v.ID))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "deadbeef\n", buf.String())
+
+	// Marshalers take precedence over String.
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.RegisterTypeTag(reflect.TypeOf(testLevel(0)), "!level")
+	require.NoError(t, enc.Encode(map[string]testLevel{"a": 3}))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "a: !level 3\n", buf.String())
+}
+
+func TestMarshalIntegerBase(t *testing.T) {
+	type perms struct {
+		Mask   uint32 `yaml:"mask,hex"`
+		Offset int    `yaml:"offset,hex"`
+		Mode   int    `yaml:"mode,oct"`
+		Flags  uint8  `yaml:"flags,bin"`
+		Limit  *int64 `yaml:"limit,hex,omitempty"`
+		Count  int
+	}
+	limit := int64(-1 << 63)
+	v := perms{Mask: 0xdeadbeef, Offset: -16, Mode: 0755, Flags: 5, Limit: &limit, Count: 10}
+	out, err := yaml.Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, "mask: 0xdeadbeef\noffset: -0x10\nmode: 0o755\nflags: 0b101\nlimit: -0x8000000000000000\ncount: 10\n", string(out))
+
+	var got perms
+	require.NoError(t, yaml.Unmarshal(out, &got))
+	require.Equal(t, v, got)
+
+	require.Panics(t, func() {
+		_, _ = yaml.Marshal(struct {
+			A string `yaml:"a,hex"`
+		}{})
+	})
+
+	// Marshalers take precedence over the base.
+	level := logLevel(2)
+	out, err = yaml.Marshal(struct {
+		A logLevel  `yaml:"a,hex"`
+		B *logLevel `yaml:"b,oct"`
+		C textLevel `yaml:"c,bin"`
+	}{A: 1, B: &level, C: 3})
+	require.NoError(t, err)
+	require.Equal(t, "a: level-1\nb: level-2\nc: text-3\n", string(out))
+}
+
+type logLevel int
+
+func (l logLevel) MarshalYAML() (interface{}, error) {
+	return fmt.Sprintf("level-%d", int(l)), nil
+}
+
+type textLevel uint8
+
+func (l textLevel) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("text-%d", int(l))), nil
+}
+
+func TestEncoderSetEncodeSets(t *testing.T) {
+	encode := func(v interface{}) string {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetEncodeSets(true)
+		require.NoError(t, enc.Encode(v))
+		require.NoError(t, enc.Close())
+		return buf.String()
+	}
+	set := map[string]struct{}{"c": {}, "a": {}, "b": {}}
+	out := encode(set)
+	require.Equal(t, "!!set\na:\nb:\nc:\n", out)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, out, encode(set))
+	}
+
+	var back map[string]struct{}
+	require.NoError(t, yaml.Unmarshal([]byte(out), &back))
+	require.Equal(t, set, back)
+
+	require.Equal(t, "ids: !!set\n    1:\n    2:\nnone: !!set {}\n", encode(map[string]interface{}{
+		"ids":  map[int]struct{}{2: {}, 1: {}},
+		"none": map[string]struct{}{},
+	}))
+
+	// Without the option the values are empty mappings.
+	data, err := yaml.Marshal(set)
+	require.NoError(t, err)
+	require.Equal(t, "a: {}\nb: {}\nc: {}\n", string(data))
+}
+
+func TestEncoderSetBoolStyle(t *testing.T) {
+	type flags struct {
+		Debug   bool
+		Verbose bool
+		Extra   *bool
+		Named   map[string]bool
+	}
+	yes := true
+	in := flags{Debug: true, Extra: &yes, Named: map[string]bool{"a": false}}
+	encode := func(trueStr, falseStr string) string {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetBoolStyle(trueStr, falseStr)
+		require.NoError(t, enc.Encode(in))
+		require.NoError(t, enc.Close())
+		return buf.String()
+	}
+
+	out := encode("yes", "no")
+	require.Equal(t, "debug: yes\nverbose: no\nextra: yes\nnamed:\n    a: no\n", out)
+	var back flags
+	require.NoError(t, yaml.Unmarshal([]byte(out), &back))
+	require.Equal(t, in, back)
+
+	out = encode("On", "OFF")
+	require.Equal(t, "debug: On\nverbose: OFF\nextra: On\nnamed:\n    a: OFF\n", out)
+	back = flags{}
+	require.NoError(t, yaml.Unmarshal([]byte(out), &back))
+	require.Equal(t, in, back)
+
+	require.Equal(t, "debug: TRUE\nverbose: False\nextra: TRUE\nnamed:\n    a: False\n", encode("TRUE", "False"))
+
+	enc := yaml.NewEncoder(io.Discard)
+	require.PanicsWithValue(t, `yaml: cannot write true as "1"`, func() { enc.SetBoolStyle("1", "0") })
+	require.PanicsWithValue(t, `yaml: cannot write false as "yes"`, func() { enc.SetBoolStyle("yes", "yes") })
+	require.PanicsWithValue(t, `yaml: cannot write true as ""`, func() { enc.SetBoolStyle("", "") })
+}
+
+func TestEncoderSetKeyStyle(t *testing.T) {
+	type entry struct {
+		Key   string
+		Count int
+	}
+	in := map[string]interface{}{
+		"123":  "456",
+		"true": "yes",
+		"name": "a: b",
+		"nested": map[string]interface{}{
+			"1.5": entry{Key: "null", Count: 1},
+		},
+		"list": []interface{}{map[string]string{"off": "on"}},
+	}
+	encode := func(v interface{}, style yaml.Style) string {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetKeyStyle(style)
+		require.NoError(t, enc.Encode(v))
+		require.NoError(t, enc.Close())
+		return buf.String()
+	}
+
+	out := encode(in, yaml.SingleQuotedStyle)
+	require.Equal(t, "'123': \"456\"\nlist:\n    - 'off': \"on\"\nname: 'a: b'\nnested:\n    '1.5':\n        key: \"null\"\n        count: 1\n'true': \"yes\"\n", out)
+	var back map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(out), &back))
+	require.Equal(t, "456", back["123"])
+	require.Equal(t, "yes", back["true"])
+
+	require.Equal(t, "\"123\": \"456\"\nlist:\n    - \"off\": \"on\"\nname: 'a: b'\nnested:\n    \"1.5\":\n        key: \"null\"\n        count: 1\n\"true\": \"yes\"\n", encode(in, yaml.DoubleQuotedStyle))
+
+	// Keys of nodes are written the same way, unless their style is set.
+	node := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "1"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "2"},
+		{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: "3"},
+		{Kind: yaml.ScalarNode, Value: "x"},
+	}}
+	require.Equal(t, "'1': \"2\"\n\"3\": x\n", encode(node, yaml.SingleQuotedStyle))
+
+	enc := yaml.NewEncoder(io.Discard)
+	require.PanicsWithValue(t, "yaml: cannot quote keys with style 8", func() { enc.SetKeyStyle(yaml.LiteralStyle) })
+}
+
+// markedList is written as the number of its items.
+type markedList []int
+
+func (l markedList) MarshalYAML() (interface{}, error) {
+	return fmt.Sprintf("%d items", len(l)), nil
+}
+
+func TestEncoderSetEmptyAsNull(t *testing.T) {
+	type config struct {
+		Tags   []string
+		Labels map[string]string
+		Ports  []int `yaml:",flow"`
+		Nested map[string]interface{}
+		Items  []interface{}
+		Skip   []string `yaml:",omitempty"`
+		Fixed  [0]int
+	}
+	in := config{
+		Tags:   []string{},
+		Ports:  []int{},
+		Nested: map[string]interface{}{"list": []int{}, "map": map[string]int{}, "marshaler": markedList{}},
+		Items:  []interface{}{[]int{}, map[string]int{}},
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetEmptyAsNull(true)
+	require.NoError(t, enc.Encode(in))
+	require.NoError(t, enc.Close())
+	out := buf.String()
+	require.Equal(t, "tags:\nlabels:\nports:\nnested:\n    list:\n    map:\n    marshaler: 0 items\nitems:\n    - []\n    - {}\nfixed:\n", out)
+
+	// Null decodes as nil, or as empty values when disabled.
+	var back config
+	require.NoError(t, yaml.Unmarshal([]byte(out), &back))
+	require.Nil(t, back.Tags)
+	require.Nil(t, back.Labels)
+	require.Nil(t, back.Nested["list"])
+	dec := yaml.NewDecoder(strings.NewReader(out))
+	dec.SetNullMode(yaml.NullMakesEmpty)
+	back = config{}
+	require.NoError(t, dec.Decode(&back))
+	require.Equal(t, []string{}, back.Tags)
+	require.Equal(t, map[string]string{}, back.Labels)
+	require.Equal(t, []int{}, back.Ports)
+
+	data, err := yaml.Marshal(in)
+	require.NoError(t, err)
+	require.Equal(t, "tags: []\nlabels: {}\nports: []\nnested:\n    list: []\n    map: {}\n    marshaler: 0 items\nitems:\n    - []\n    - {}\nfixed: []\n", string(data))
+}
+
+func TestEncoderSetMinimalTags(t *testing.T) {
+	const data = "a: !!int 1\nb: !!bool true\nc: !!str 123\nd: !!str abc\ne: !!str 'x'\nf: !!float 1\ni: !!int '1'\nj: !custom v\n"
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &node))
+
+	encode := func(minimal bool) string {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetMinimalTags(minimal)
+		require.NoError(t, enc.Encode(&node))
+		require.NoError(t, enc.Close())
+		return buf.String()
+	}
+
+	// Explicit tags are kept by default.
+	require.Equal(t, data, encode(false))
+
+	// Tags the value would resolve to anyway are dropped; the rest are kept.
+	out := encode(true)
+	require.Equal(t, "a: 1\nb: true\nc: \"123\"\nd: abc\ne: 'x'\nf: !!float 1\ni: !!int '1'\nj: !custom v\n", out)
+
+	var want, got interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &want))
+	require.NoError(t, yaml.Unmarshal([]byte(out), &got))
+	require.Equal(t, want, got)
+
+	// Tags that are not explicit are dropped from quoted values as before,
+	// while SetMinimalTags keeps them so the value keeps its type.
+	node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: "1", Style: yaml.SingleQuotedStyle}
+	require.Equal(t, "'1'\n", encode(false))
+	require.Equal(t, "!!int '1'\n", encode(true))
+}
+
+func TestEncoderSetVersionDirective(t *testing.T) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetVersionDirective(1, 1)
+	require.NoError(t, enc.Encode(map[string]int{"a": 1}))
+	require.NoError(t, enc.Encode(map[string]int{"b": 2}))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "%YAML 1.1\n---\na: 1\n---\nb: 2\n", buf.String())
+
+	version, _, err := yaml.Directives(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, &yaml.VersionDirective{Major: 1, Minor: 1}, version)
+	var v map[string]int
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &v))
+	require.Equal(t, map[string]int{"a": 1}, v)
+
+	buf.Reset()
+	enc = yaml.NewEncoder(&buf)
+	enc.SetVersionDirective(1, 2)
+	require.NoError(t, enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "x"}}}))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "%YAML 1.2\n---\nx\n", buf.String())
+	dec := yaml.NewDecoder(&buf)
+	dec.SetAcceptedVersions([2]int{1, 2})
+	var s string
+	require.NoError(t, dec.Decode(&s))
+	require.Equal(t, "x", s)
+
+	require.Panics(t, func() { yaml.NewEncoder(&buf).SetVersionDirective(1, 3) })
+}
@@ -1,8 +1,10 @@
 package fuzz
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -75,6 +77,10 @@ var testData = []string{
 		` Generic line break (glyphed)\n\` + "\n" +
 		` Line separator\u2028\` + "\n" +
 		` Paragraph separator\u2029"` + "\n",
+	"%YAML 1.2\n---\na: 1\n",
+	"?\ta\n:\tb\n",
+	"a: \"\\uD83D\\uDE00\"\n",
+	"a: &" + strings.Repeat("x", 1025) + " 1\n",
 	"a: {b: https://github.com/go-yaml/yaml}",
 	"a: [https://github.com/go-yaml/yaml]",
 	"a: 3s",
@@ -106,6 +112,39 @@ var testData = []string{
 	"\n0:\n<<:\n  {}:\n",
 }
 
+// acceptedInputs match inputs that yaml.v3 rejects and this package
+// intentionally accepts.
+var acceptedInputs = []*regexp.Regexp{
+	// A tab separating an explicit key or value indicator from its node.
+	regexp.MustCompile(`[?:] *\t`),
+	// A UTF-16 surrogate pair escape in a double-quoted scalar.
+	regexp.MustCompile(`\\u[dD][89abAB][0-9a-fA-F]{2}\\u[dD][c-fC-F][0-9a-fA-F]{2}`),
+}
+
+// rejectedMsgs are in errors for inputs that yaml.v3 accepts and this
+// package rejects by default.
+var rejectedMsgs = []string{
+	"found anchor name longer than",
+}
+
+func isRejectedInput(err error) bool {
+	for _, msg := range rejectedMsgs {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAcceptedInput(data string) bool {
+	for _, re := range acceptedInputs {
+		if re.MatchString(data) {
+			return true
+		}
+	}
+	return false
+}
+
 type M map[string]interface{}
 
 type exStruct struct {
@@ -259,6 +298,11 @@ func assertUnmarshalErr(t testing.TB, v3err, err error) {
 			}
 		}
 	}
+	// yaml.v3 returns syntax errors as plain errors with the same message.
+	var syntaxErr *yaml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		err = errors.New(msg)
+	}
 	require.EqualValues(t, v3err, err)
 }
 
@@ -277,6 +321,14 @@ func roundTripCompatibility(t *testing.T, data string, val, v3Val any) {
 	if v3recovered != nil {
 		return
 	}
+	// don't continue if v3 rejects input we accept on purpose
+	if v3err != nil && err == nil && isAcceptedInput(data) {
+		return
+	}
+	// don't continue if we reject input v3 accepts on purpose
+	if v3err == nil && err != nil && isRejectedInput(err) {
+		return
+	}
 	assertUnmarshalErr(t, v3err, err)
 	// compare values only if val and v3val are the same type
 	if reflect.TypeOf(val) == reflect.TypeOf(v3Val) {
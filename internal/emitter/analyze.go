@@ -47,7 +47,7 @@ func analyzeTag(e *Emitter, tag []byte) error {
 }
 
 func analyzeVersionDirective(version_directive *yamlh.VersionDirective) error {
-	if version_directive.Major != 1 || version_directive.Minor != 1 {
+	if version_directive.Major != 1 || version_directive.Minor != 1 && version_directive.Minor != 2 {
 		return errors.New(`incompatible %YAML directive`)
 	}
 	return nil
@@ -233,7 +233,7 @@ func analyzeEvent(e *Emitter, event *yamlh.Event) error {
 		e.scalarData = analyzeScalar(event.Value)
 	case yamlh.SEQUENCE_START_EVENT, yamlh.MAPPING_START_EVENT:
 		if len(event.Anchor) > 0 {
-			err = analyzeAnchor(e, event.Anchor, true)
+			err = analyzeAnchor(e, event.Anchor, false)
 			if err != nil {
 				return err
 			}
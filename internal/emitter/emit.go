@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/willabides/yaml/internal/common"
+	"github.com/willabides/yaml/internal/resolve"
 	"github.com/willabides/yaml/internal/yamlh"
 )
 
@@ -77,7 +78,8 @@ func emitDocumentStartEvent(e *Emitter, event *yamlh.Event, first bool) error {
 
 	if event.Version_directive != nil {
 		implicit = false
-		err := writeIndicator(e, []byte("%YAML 1.1"), true, false, false)
+		directive := fmt.Sprintf("%%YAML %d.%d", event.Version_directive.Major, event.Version_directive.Minor)
+		err := writeIndicator(e, []byte(directive), true, false, false)
 		if err != nil {
 			return err
 		}
@@ -154,6 +156,11 @@ func selectScalarStyle(e *Emitter, event *yamlh.Event) error {
 	if e.simpleKeyContext && e.scalarData.multiline {
 		style = yamlh.DOUBLE_QUOTED_SCALAR_STYLE
 	}
+	if e.compactFlow && e.flowLevel > 0 && e.simpleKeyContext && style == yamlh.PLAIN_SCALAR_STYLE && event.Quoted_implicit {
+		if tag, _, _ := resolve.Resolve("", string(event.Value)); tag == resolve.StrTag {
+			style = yamlh.DOUBLE_QUOTED_SCALAR_STYLE
+		}
+	}
 
 	if style == yamlh.PLAIN_SCALAR_STYLE {
 		if e.flowLevel > 0 && !e.scalarData.flowPlainAllowed ||
@@ -176,6 +183,9 @@ func selectScalarStyle(e *Emitter, event *yamlh.Event) error {
 		if !e.scalarData.blockAllowed || e.flowLevel > 0 || e.simpleKeyContext {
 			style = yamlh.DOUBLE_QUOTED_SCALAR_STYLE
 		}
+		if e.stripChomping && endsWithBreak(e.scalarData.value) {
+			style = yamlh.DOUBLE_QUOTED_SCALAR_STYLE
+		}
 	}
 
 	if no_tag && !event.Quoted_implicit && style != yamlh.PLAIN_SCALAR_STYLE {
@@ -185,6 +195,18 @@ func selectScalarStyle(e *Emitter, event *yamlh.Event) error {
 	return nil
 }
 
+// endsWithBreak returns whether value ends with a line break.
+func endsWithBreak(value []byte) bool {
+	if len(value) == 0 {
+		return false
+	}
+	i := len(value) - 1
+	for i > 0 && value[i]&0xC0 == 0x80 {
+		i--
+	}
+	return yamlh.Is_break(value, i)
+}
+
 func stateMachine(e *Emitter, event *yamlh.Event) error {
 	switch e.state {
 	default:
@@ -384,6 +406,7 @@ func emitFlowSequenceItem(e *Emitter, event *yamlh.Event, first, trail bool) err
 		if err != nil {
 			return err
 		}
+		e.lastCharWhitepace = e.compactFlow
 	}
 
 	err = processHeadComment(e)
@@ -397,7 +420,7 @@ func emitFlowSequenceItem(e *Emitter, event *yamlh.Event, first, trail bool) err
 		}
 	}
 
-	if e.column > e.width {
+	if e.flowWrap(event) {
 		err = writeIndent(e)
 		if err != nil {
 			return err
@@ -477,6 +500,7 @@ func emitFlowMappingKey(e *Emitter, event *yamlh.Event, first, trail bool) error
 		if err != nil {
 			return err
 		}
+		e.lastCharWhitepace = e.compactFlow
 	}
 
 	err = processHeadComment(e)
@@ -491,7 +515,7 @@ func emitFlowMappingKey(e *Emitter, event *yamlh.Event, first, trail bool) error
 		}
 	}
 
-	if e.column > e.width {
+	if e.flowWrap(event) {
 		err = writeIndent(e)
 		if err != nil {
 			return err
@@ -500,7 +524,9 @@ func emitFlowMappingKey(e *Emitter, event *yamlh.Event, first, trail bool) error
 
 	if checkSimpleKey(e) {
 		e.states = append(e.states, emitFlowMappingSimpleValueState)
-		return emitNode(e, event, false, true)
+		err = emitNode(e, event, false, true)
+		e.quotedKey = event.Type == yamlh.SCALAR_EVENT && e.scalarData.style != yamlh.PLAIN_SCALAR_STYLE
+		return err
 	}
 	err = writeIndicator(e, []byte{'?'}, true, false, false)
 	if err != nil {
@@ -518,6 +544,7 @@ func emitFlowMappingValue(e *Emitter, event *yamlh.Event, simple bool) error {
 		if err != nil {
 			return err
 		}
+		e.lastCharWhitepace = e.compactFlow && e.quotedKey
 	} else {
 		if e.column > e.width {
 			err = writeIndent(e)
@@ -552,17 +579,28 @@ func emitFlowMappingValue(e *Emitter, event *yamlh.Event, simple bool) error {
 	return processFootComment(e)
 }
 
+// processCollectionFootComment writes the foot comment of a block
+// collection that just ended below its last entry, rather than after
+// whatever follows it. The foot comment of the root is left to the end of
+// the document, which separates it from the content.
+func processCollectionFootComment(e *Emitter) error {
+	if e.state == emitDocumentEndState {
+		return nil
+	}
+	return processFootComment(e)
+}
+
 // expect a block item node.
 func emitBlockSequenceItem(e *Emitter, event *yamlh.Event, first bool) error {
 	if first {
-		e.increaseIndent(false, false)
+		e.increaseSequenceIndent()
 	}
 	if event.Type == yamlh.SEQUENCE_END_EVENT {
 		e.indentLevel = e.indentStack[len(e.indentStack)-1]
 		e.indentStack = e.indentStack[:len(e.indentStack)-1]
 		e.state = e.states[len(e.states)-1]
 		e.states = e.states[:len(e.states)-1]
-		return nil
+		return processCollectionFootComment(e)
 	}
 	err := processHeadComment(e)
 	if err != nil {
@@ -592,6 +630,8 @@ func emitBlockSequenceItem(e *Emitter, event *yamlh.Event, first bool) error {
 func emitBlockMappingKey(e *Emitter, event *yamlh.Event, first bool) error {
 	if first {
 		e.increaseIndent(false, false)
+	} else if event.Type != yamlh.MAPPING_END_EVENT {
+		e.blankLines = event.Blank_lines
 	}
 	err := processHeadComment(e)
 	if err != nil {
@@ -602,7 +642,7 @@ func emitBlockMappingKey(e *Emitter, event *yamlh.Event, first bool) error {
 		e.indentStack = e.indentStack[:len(e.indentStack)-1]
 		e.state = e.states[len(e.states)-1]
 		e.states = e.states[:len(e.states)-1]
-		return nil
+		return processCollectionFootComment(e)
 	}
 	err = writeIndent(e)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"unicode/utf8"
 
 	"github.com/willabides/yaml/internal/yamlh"
 )
@@ -55,7 +56,14 @@ type Emitter struct {
 	// Emitter stuff
 
 	indent int // The number of indentation spaces.
-	width  int // The preferred width of the output lines.
+
+	sequenceIndent int  // The indentation of block sequences under a mapping key, or -1 to use indent.
+	width          int  // The preferred width of the output lines.
+	keepChomping   bool // Use the keep chomping indicator for all block scalars ending with a line break.
+	stripChomping  bool // Only use block scalars for values that end without a line break.
+	flowWidth      int  // The width at which flow collection items are wrapped, or 0 for the preferred width.
+	compactFlow    bool // Omit the spaces after ',' and ':' in flow collections?
+	blockIndent    int  // The extra indentation of block scalar content.
 
 	state  emitterState   // The current emitter State.
 	states []emitterState // The stack of States.
@@ -79,6 +87,7 @@ type Emitter struct {
 	lastCharWhitepace bool // If the last character was a Whitespace?
 	lastCharIndent    bool // If the last character was an indentation character (' ', '-', '?', ':')?
 	openEnded         bool // If an explicit document end is required?
+	quotedKey         bool // If the last simple key of a flow mapping was quoted?
 
 	footIndent int // The Indent used to write the foot comment above, or -1 if none.
 
@@ -103,6 +112,8 @@ type Emitter struct {
 	footComment    []byte
 	tailComment    []byte
 	keyLineComment []byte
+
+	blankLines int // The blank lines to write before the head comment of the next block mapping key.
 }
 
 func New(w io.Writer) *Emitter {
@@ -112,6 +123,8 @@ func New(w io.Writer) *Emitter {
 		eventsQueue: make([]yamlh.Event, 0, yamlh.Initial_queue_size),
 		width:       -1,
 		indent:      4,
+
+		sequenceIndent: -1,
 	}
 }
 
@@ -142,6 +155,55 @@ func (e *Emitter) SetIndent(spaces int) {
 	e.indent = spaces
 }
 
+// SetSequenceIndent sets the indentation of block sequences that are the
+// value of a block mapping key, relative to the key. 0 writes the dashes
+// aligned with the key.
+func (e *Emitter) SetSequenceIndent(spaces int) {
+	if spaces < 0 {
+		panic("yaml: cannot indent sequences by a negative number of spaces")
+	}
+	e.sequenceIndent = spaces
+}
+
+// SetKeepChomping makes block scalars ending with a single line break use
+// the keep chomping indicator "+" rather than the default clip.
+func (e *Emitter) SetKeepChomping(enable bool) {
+	e.keepChomping = enable
+}
+
+// SetStripChomping makes all block scalars use the strip chomping indicator
+// "-". Values ending with a line break, which it would drop, are written
+// double-quoted instead.
+func (e *Emitter) SetStripChomping(enable bool) {
+	e.stripChomping = enable
+}
+
+// SetBlockScalarIndent adds spaces to the indentation of the content of
+// literal and folded scalars, which is then given by an explicit indentation
+// indicator.
+func (e *Emitter) SetBlockScalarIndent(spaces int) {
+	if spaces < 0 {
+		panic("yaml: cannot indent block scalars by a negative number of spaces")
+	}
+	e.blockIndent = spaces
+}
+
+// SetFlowWidth makes flow collections wrap before an item that would make
+// the line exceed columns characters. 0 disables it.
+func (e *Emitter) SetFlowWidth(columns int) {
+	if columns < 0 {
+		panic("yaml: cannot wrap flow collections at a negative width")
+	}
+	e.flowWidth = columns
+}
+
+// SetCompactFlow omits the spaces after ',' and ':' in flow collections.
+// Plain keys resolving to strings are double-quoted so they may be directly
+// followed by ':'.
+func (e *Emitter) SetCompactFlow(enable bool) {
+	e.compactFlow = enable
+}
+
 // put a byte on the output buffer.
 func (e *Emitter) put(value byte) error {
 	_, err := e.writer.Write([]byte{value})
@@ -222,6 +284,9 @@ func (e *Emitter) readyToEmit() bool {
 	}
 	var accumulate int
 	switch e.eventsQueue[e.eventsHead].Type {
+	case yamlh.SCALAR_EVENT:
+		// Wrapping a flow mapping key depends on the width of its value.
+		return e.flowWidth == 0 || !isFlowMappingKeyState(e.state) || len(e.eventsQueue)-e.eventsHead > 1
 	case yamlh.DOCUMENT_START_EVENT:
 		accumulate = 1
 	case yamlh.SEQUENCE_START_EVENT:
@@ -271,6 +336,73 @@ func (e *Emitter) increaseIndent(flow, indentless bool) {
 	}
 }
 
+// increaseSequenceIndent increases the indentation for a block sequence,
+// applying sequenceIndent when it is the value of a block mapping key.
+func (e *Emitter) increaseSequenceIndent() {
+	if e.sequenceIndent < 0 || e.indentLevel < 0 || e.states[len(e.states)-1] != emitBlockMappingKeyState {
+		e.increaseIndent(false, false)
+		return
+	}
+	e.indentStack = append(e.indentStack, e.indentLevel)
+	e.indentLevel += e.sequenceIndent
+}
+
+// flowWrap reports whether the flow collection item starting with event
+// must be written on a new line. Without a flow width, items are wrapped
+// once the preferred width is exceeded.
+func (e *Emitter) flowWrap(event *yamlh.Event) bool {
+	if e.flowWidth == 0 {
+		return e.column > e.width
+	}
+	if e.column <= e.indentLevel {
+		return false
+	}
+	// The item is preceded by a space and followed by a comma. Collections
+	// only need room for their opening indicator.
+	n := 2 + len(e.anchorData.Anchor) + len(e.tagData.Handle) + len(e.tagData.Suffix)
+	if len(e.anchorData.Anchor) > 0 {
+		n += 2
+	}
+	if len(e.tagData.Handle)+len(e.tagData.Suffix) > 0 {
+		n++
+	}
+	if event.Type != yamlh.SCALAR_EVENT {
+		return e.column+n+1 > e.flowWidth
+	}
+	n += scalarWidth(event, e.scalarData)
+	// A mapping key is kept on the line of its value, which readyToEmit
+	// queues along with the key.
+	if e.eventsHead+1 < len(e.eventsQueue) && isFlowMappingKeyState(e.state) {
+		value := &e.eventsQueue[e.eventsHead+1]
+		n += 2
+		if value.Type == yamlh.SCALAR_EVENT {
+			n += scalarWidth(value, analyzeScalar(value.Value))
+		} else {
+			n++
+		}
+	}
+	return e.column+n > e.flowWidth
+}
+
+// scalarWidth estimates the number of columns used to write the scalar
+// event analyzed as data.
+func scalarWidth(event *yamlh.Event, data scalarData) int {
+	n := utf8.RuneCount(event.Value)
+	style := yamlh.YamlScalarStyle(event.Style)
+	if data.flowPlainAllowed && (style == yamlh.ANY_SCALAR_STYLE || style == yamlh.PLAIN_SCALAR_STYLE) {
+		return n
+	}
+	return n + 2 + bytes.Count(event.Value, []byte{'\''})
+}
+
+func isFlowMappingKeyState(state emitterState) bool {
+	switch state {
+	case emitFlowMappingFirstKeyState, emitFlowMappingTrailKeyState, emitFlowMappingKeyState:
+		return true
+	}
+	return false
+}
+
 // appendTagDirective - Append a directive to the directives stack.
 func appendTagDirective(e *Emitter, value *yamlh.TagDirective, allow_duplicates bool) error {
 	for i := 0; i < len(e.tagDirectives); i++ {
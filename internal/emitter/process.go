@@ -107,6 +107,12 @@ func processHeadComment(e *Emitter) error {
 		}
 	}
 
+	blankLines := e.blankLines > 0
+	err = writeBlankLines(e)
+	if err != nil {
+		return err
+	}
+
 	if len(e.headComment) == 0 {
 		return nil
 	}
@@ -118,6 +124,14 @@ func processHeadComment(e *Emitter) error {
 	if err != nil {
 		return err
 	}
+	// Along with the blank lines before it, keep the empty line that the
+	// trailing line break of the head comment stands for.
+	if blankLines && yamlh.Is_break(e.headComment, len(e.headComment)-1) {
+		err = e.putBreak()
+		if err != nil {
+			return err
+		}
+	}
 	e.headComment = e.headComment[:0]
 	return nil
 }
@@ -1,6 +1,10 @@
 package emitter
 
-import "github.com/willabides/yaml/internal/yamlh"
+import (
+	"fmt"
+
+	"github.com/willabides/yaml/internal/yamlh"
+)
 
 // writeBom writes the BOM character.
 func writeBom(e *Emitter) error {
@@ -35,6 +39,37 @@ func writeIndent(e *Emitter) error {
 	return nil
 }
 
+// writeBlankLines writes the blank lines requested before a block mapping
+// key, counting the one writeIndent adds after a foot comment.
+func writeBlankLines(e *Emitter) error {
+	n := e.blankLines
+	e.blankLines = 0
+	indent := e.indentLevel
+	if indent < 0 {
+		indent = 0
+	}
+	if e.footIndent == indent {
+		n--
+	}
+	if n <= 0 {
+		return nil
+	}
+	if e.column > 0 {
+		err := e.putBreak()
+		if err != nil {
+			return err
+		}
+	}
+	for ; n > 0; n-- {
+		err := e.putBreak()
+		if err != nil {
+			return err
+		}
+	}
+	e.lastCharWhitepace = true
+	return nil
+}
+
 func writeIndicator(e *Emitter, indicator []byte, need_whitespace, is_whitespace, is_indention bool) error {
 	if need_whitespace && !e.lastCharWhitepace {
 		err := e.put(' ')
@@ -446,8 +481,18 @@ func writeDoubleQuotedEscapedChar(e *Emitter, value []byte) ([]byte, error) {
 
 func writeBlockScalarHints(e *Emitter, value []byte) error {
 	var err error
-	if yamlh.Is_space(value, 0) || yamlh.Is_break(value, 0) {
-		indent_hint := []byte{'0' + byte(e.indent)}
+	if e.blockIndent > 0 || yamlh.Is_space(value, 0) || yamlh.Is_break(value, 0) {
+		// The indicator is relative to the indentation of the enclosing
+		// block collection, or to column 0 at the top level.
+		parent := e.indentStack[len(e.indentStack)-1]
+		if parent < 0 {
+			parent = 0
+		}
+		hint := e.indentLevel + e.blockIndent - parent
+		if hint > 9 {
+			return fmt.Errorf("block scalar indentation of %d spaces exceeds the maximum of 9", hint)
+		}
+		indent_hint := []byte{'0' + byte(hint)}
 		err = writeIndicator(e, indent_hint, false, false, false)
 		if err != nil {
 			return err
@@ -467,7 +512,7 @@ func writeBlockScalarHints(e *Emitter, value []byte) error {
 		switch {
 		case !yamlh.Is_break(value, i):
 			chomp_hint[0] = '-'
-		case i == 0:
+		case i == 0 || e.keepChomping:
 			chomp_hint[0] = '+'
 			e.openEnded = true
 		default:
@@ -503,6 +548,8 @@ func writeLiteralScalar(e *Emitter, value []byte) error {
 	if err != nil {
 		return err
 	}
+	e.indentLevel += e.blockIndent
+	defer func() { e.indentLevel -= e.blockIndent }()
 	e.lastCharWhitepace = true
 	breaks := true
 	for len(value) > 0 {
@@ -547,6 +594,8 @@ func writeFoldedScalar(e *Emitter, value []byte) error {
 		return err
 	}
 
+	e.indentLevel += e.blockIndent
+	defer func() { e.indentLevel -= e.blockIndent }()
 	e.lastCharWhitepace = true
 
 	breaks := true
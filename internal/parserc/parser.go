@@ -116,6 +116,22 @@ type YamlParser struct {
 	Offset int            // The Offset of the current position (in bytes).
 	Mark   yamlh.Position // The Mark of the current position.
 
+	Max_input_bytes int64 // The maximum number of Input bytes to consume, or 0 for no limit.
+
+	Reject_tabs bool            // Fail on any tab character?
+	Tab_mark    *yamlh.Position // The position of the first tab found when rejecting tabs.
+
+	Max_lines  int             // The maximum number of lines to read, or 0 for no limit.
+	Lines_mark *yamlh.Position // The position of the first character found beyond Max_lines.
+
+	Max_anchor_len int // The maximum length of anchor and alias names, 0 for default_max_anchor_len, or less than 0 for no limit.
+
+	Accepted_versions  [][2]int // The %YAML versions accepted, or nil for 1.1 only.
+	Lenient_directives bool     // Let the last of duplicate directives win rather than failing?
+
+	Error_recovery bool                // Skip the lines of keys missing ':' rather than failing?
+	Warnings       []yamlh.SyntaxError // The errors recovered from.
+
 	// Comments
 
 	Head_comment []byte // The current head comments
@@ -161,3 +177,21 @@ func New(reader io.Reader) *YamlParser {
 		Reader:     reader,
 	}
 }
+
+// SetReadBufferSize sets the number of bytes read from the Reader at a
+// time. Sizes smaller than the default are raised to it. Data already read
+// and not yet parsed is kept.
+func (parser *YamlParser) SetReadBufferSize(n int) {
+	if n < yamlh.Input_raw_buffer_size {
+		n = yamlh.Input_raw_buffer_size
+	}
+	raw := parser.Raw_buffer[parser.Raw_buffer_pos:]
+	if n < len(raw) {
+		n = len(raw)
+	}
+	buf := parser.Buffer[parser.Buffer_pos:]
+	parser.Raw_buffer = append(make([]byte, 0, n), raw...)
+	parser.Raw_buffer_pos = 0
+	parser.Buffer = append(make([]byte, 0, len(buf)+n*3), buf...)
+	parser.Buffer_pos = 0
+}
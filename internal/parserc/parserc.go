@@ -25,7 +25,6 @@ package parserc
 import (
 	"bytes"
 	"fmt"
-	"strconv"
 
 	"github.com/willabides/yaml/internal/common"
 	"github.com/willabides/yaml/internal/yamlh"
@@ -123,6 +122,11 @@ func yaml_parser_unfold_comments(parser *YamlParser, token *yamlh.YamlToken) {
 		*comment = yamlh.YamlComment{}
 		parser.Comments_head++
 	}
+	if parser.Comments_head == len(parser.Comments) {
+		// Reuse the queue so it doesn't grow with the number of comments.
+		parser.Comments = parser.Comments[:0]
+		parser.Comments_head = 0
+	}
 }
 
 // Remove the next token from the queue (must be called after peek_token).
@@ -133,26 +137,32 @@ func skip_token(parser *YamlParser) {
 	parser.Tokens_head++
 }
 
-func buildParserError(errType yamlh.ErrorType, problem string, problemLine, contextLine int) error {
+func buildParserError(errType yamlh.ErrorType, problem string, problemMark, contextMark yamlh.Position) error {
 	if errType == yamlh.NO_ERROR {
 		return nil
 	}
-	var where string
-	line := contextLine
-	if line == 0 {
-		line = problemLine
+	mark := contextMark
+	if mark.Line == 0 {
+		mark = problemMark
+	}
+	if problem == "" {
+		problem = "unknown problem parsing YAML content"
 	}
-	if line != 0 {
+	if errType == yamlh.READER_ERROR {
+		// Reader errors have no position.
+		return &yamlh.SyntaxError{Kind: errType, Problem: problem}
+	}
+	// As in yaml.v3, the message leaves out the first line, and reports
+	// the line before the problem for parser errors.
+	messageLine := 0
+	if mark.Line != 0 {
+		messageLine = mark.Line
 		// Scanner errors don't iterate line before returning error
 		if errType == yamlh.SCANNER_ERROR {
-			line++
+			messageLine++
 		}
-		where = "line " + strconv.Itoa(line) + ": "
 	}
-	if problem == "" {
-		problem = "unknown problem parsing YAML content"
-	}
-	return fmt.Errorf("yaml: %s%s", where, problem)
+	return yamlh.NewSyntaxError(errType, mark, messageLine, problem)
 }
 
 // State dispatcher.
@@ -242,7 +252,7 @@ func yaml_parser_parse_stream_start(parser *YamlParser) (*yamlh.Event, error) {
 		return nil, err
 	}
 	if token.Type != yamlh.STREAM_START_TOKEN {
-		return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected <stream-start>", token.Start_mark.Line, 0)
+		return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected <stream-start>", token.Start_mark, yamlh.Position{})
 	}
 	parser.State = PARSE_IMPLICIT_DOCUMENT_START_STATE
 	event := yamlh.Event{
@@ -336,7 +346,7 @@ func yaml_parser_parse_document_start(parser *YamlParser, implicit bool) (*yamlh
 			return nil, err
 		}
 		if token.Type != yamlh.DOCUMENT_START_TOKEN {
-			return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected <document start>", token.Start_mark.Line, 0)
+			return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected <document start>", token.Start_mark, yamlh.Position{})
 		}
 		parser.States = append(parser.States, PARSE_DOCUMENT_END_STATE)
 		parser.State = PARSE_DOCUMENT_CONTENT_STATE
@@ -562,7 +572,7 @@ func yaml_parser_parse_node(parser *YamlParser, block, indentless_sequence bool)
 				}
 			}
 			if len(tag) == 0 {
-				return nil, buildParserError(yamlh.PARSER_ERROR, "found undefined tag handle", tag_mark.Line, start_mark.Line)
+				return nil, buildParserError(yamlh.PARSER_ERROR, "found undefined tag handle", tag_mark, start_mark)
 			}
 		}
 	}
@@ -692,7 +702,7 @@ func yaml_parser_parse_node(parser *YamlParser, block, indentless_sequence bool)
 		return &event, nil
 	}
 
-	return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected node content", token.Start_mark.Line, start_mark.Line)
+	return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected node content", token.Start_mark, start_mark)
 }
 
 // Parse the productions:
@@ -750,7 +760,7 @@ func yaml_parser_parse_block_sequence_entry(parser *YamlParser, first bool) (*ya
 
 	context_mark := parser.Marks[len(parser.Marks)-1]
 	parser.Marks = parser.Marks[:len(parser.Marks)-1]
-	return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected '-' indicator", token.Start_mark.Line, context_mark.Line)
+	return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected '-' indicator", token.Start_mark, context_mark)
 }
 
 // Parse the productions:
@@ -894,7 +904,7 @@ func yaml_parser_parse_block_mapping_key(parser *YamlParser, first bool) (*yamlh
 
 	context_mark := parser.Marks[len(parser.Marks)-1]
 	parser.Marks = parser.Marks[:len(parser.Marks)-1]
-	return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected key", token.Start_mark.Line, context_mark.Line)
+	return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected key", token.Start_mark, context_mark)
 }
 
 // Parse the productions:
@@ -968,7 +978,7 @@ func yaml_parser_parse_flow_sequence_entry(parser *YamlParser, first bool) (*yam
 			} else {
 				context_mark := parser.Marks[len(parser.Marks)-1]
 				parser.Marks = parser.Marks[:len(parser.Marks)-1]
-				return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected ',' or ']'", token.Start_mark.Line, context_mark.Line)
+				return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected ',' or ']'", token.Start_mark, context_mark)
 			}
 		}
 
@@ -1107,7 +1117,7 @@ func yaml_parser_parse_flow_mapping_key(parser *YamlParser, first bool) (*yamlh.
 			} else {
 				context_mark := parser.Marks[len(parser.Marks)-1]
 				parser.Marks = parser.Marks[:len(parser.Marks)-1]
-				return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected ',' or '}'", token.Start_mark.Line, context_mark.Line)
+				return nil, buildParserError(yamlh.PARSER_ERROR, "did not find expected ',' or '}'", token.Start_mark, context_mark)
 			}
 		}
 
@@ -1184,6 +1194,20 @@ func yaml_parser_process_empty_scalar(mark yamlh.Position) *yamlh.Event {
 	}
 }
 
+// versionAccepted reports whether a %YAML directive for major.minor is
+// accepted by the parser.
+func versionAccepted(parser *YamlParser, major, minor int8) bool {
+	if parser.Accepted_versions == nil {
+		return major == 1 && minor == 1
+	}
+	for _, v := range parser.Accepted_versions {
+		if v[0] == int(major) && v[1] == int(minor) {
+			return true
+		}
+	}
+	return false
+}
+
 // Parse directives.
 func yaml_parser_process_directives(parser *YamlParser,
 	version_directive_ref **yamlh.VersionDirective,
@@ -1199,11 +1223,16 @@ func yaml_parser_process_directives(parser *YamlParser,
 
 	for token.Type == yamlh.VERSION_DIRECTIVE_TOKEN || token.Type == yamlh.TAG_DIRECTIVE_TOKEN {
 		if token.Type == yamlh.VERSION_DIRECTIVE_TOKEN {
-			if version_directive != nil {
-				return buildParserError(yamlh.PARSER_ERROR, "found duplicate %YAML directive", token.Start_mark.Line, 0)
+			if version_directive != nil && !parser.Lenient_directives {
+				return buildParserError(yamlh.PARSER_ERROR, "found duplicate %YAML directive", token.Start_mark, yamlh.Position{})
 			}
-			if token.Major != 1 || token.Minor != 1 {
-				return buildParserError(yamlh.PARSER_ERROR, "found incompatible YAML document", token.Start_mark.Line, 0)
+			if !versionAccepted(parser, token.Major, token.Minor) {
+				// Keep the yaml.v3 message unless versions were configured.
+				problem := "found incompatible YAML document"
+				if parser.Accepted_versions != nil {
+					problem = fmt.Sprintf("found unsupported YAML version %d.%d", token.Major, token.Minor)
+				}
+				return buildParserError(yamlh.PARSER_ERROR, problem, token.Start_mark, yamlh.Position{})
 			}
 			version_directive = &yamlh.VersionDirective{
 				Major: token.Major,
@@ -1214,11 +1243,13 @@ func yaml_parser_process_directives(parser *YamlParser,
 				Handle: token.Value,
 				Prefix: token.Prefix,
 			}
-			err = yaml_parser_append_tag_directive(parser, value, false, token.Start_mark)
-			if err != nil {
-				return err
+			if !parser.Lenient_directives || !replaceTagDirective(parser, &tag_directives, value) {
+				err = yaml_parser_append_tag_directive(parser, value, false, token.Start_mark)
+				if err != nil {
+					return err
+				}
+				tag_directives = append(tag_directives, value)
 			}
-			tag_directives = append(tag_directives, value)
 		}
 
 		skip_token(parser)
@@ -1244,6 +1275,25 @@ func yaml_parser_process_directives(parser *YamlParser,
 	return nil
 }
 
+// replaceTagDirective replaces the prefix of the tag directive for the
+// handle of value, for the last of duplicate directives to win. It returns
+// false if there is no directive for the handle yet.
+func replaceTagDirective(parser *YamlParser, tag_directives *[]yamlh.TagDirective, value yamlh.TagDirective) bool {
+	found := false
+	for i := range parser.Tag_directives {
+		if bytes.Equal(value.Handle, parser.Tag_directives[i].Handle) {
+			parser.Tag_directives[i].Prefix = append([]byte(nil), value.Prefix...)
+			found = true
+		}
+	}
+	for i := range *tag_directives {
+		if bytes.Equal(value.Handle, (*tag_directives)[i].Handle) {
+			(*tag_directives)[i] = value
+		}
+	}
+	return found
+}
+
 // Append a tag directive to the directives stack.
 func yaml_parser_append_tag_directive(parser *YamlParser, value yamlh.TagDirective, allow_duplicates bool, mark yamlh.Position) error {
 	for i := range parser.Tag_directives {
@@ -1251,7 +1301,7 @@ func yaml_parser_append_tag_directive(parser *YamlParser, value yamlh.TagDirecti
 			if allow_duplicates {
 				return nil
 			}
-			return buildParserError(yamlh.PARSER_ERROR, "found duplicate %TAG directive", mark.Line, 0)
+			return buildParserError(yamlh.PARSER_ERROR, "found duplicate %TAG directive", mark, yamlh.Position{})
 		}
 	}
 
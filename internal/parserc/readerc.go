@@ -24,13 +24,14 @@ package parserc
 
 import (
 	"io"
+	"strconv"
 
 	"github.com/willabides/yaml/internal/yamlh"
 )
 
 // Set the reader error and return 0.
 func newReaderError(problem string) error {
-	return buildParserError(yamlh.READER_ERROR, problem, 0, 0)
+	return buildParserError(yamlh.READER_ERROR, problem, yamlh.Position{}, yamlh.Position{})
 }
 
 // Byte order marks.
@@ -359,6 +360,9 @@ func yaml_parser_update_buffer(parser *YamlParser, length int) error {
 			// Move the raw pointers.
 			parser.Raw_buffer_pos += width
 			parser.Offset += width
+			if parser.Max_input_bytes > 0 && int64(parser.Offset) > parser.Max_input_bytes {
+				return newReaderError("input exceeds the maximum size of " + strconv.FormatInt(parser.Max_input_bytes, 10) + " bytes")
+			}
 
 			// Finally put the character into the buffer.
 			switch {
@@ -521,8 +521,22 @@ func yaml_insert_token(parser *YamlParser, pos int, token *yamlh.YamlToken) {
 	parser.Tokens[parser.Tokens_head+pos] = *token
 }
 
+// checkChar records the position of the current character when it is a tab
+// and tabs are rejected, or when it is beyond Max_lines.
+func checkChar(parser *YamlParser) {
+	if parser.Reject_tabs && parser.Tab_mark == nil && parser.Buffer[parser.Buffer_pos] == '\t' {
+		mark := parser.Mark
+		parser.Tab_mark = &mark
+	}
+	if parser.Max_lines > 0 && parser.Lines_mark == nil && parser.Mark.Line >= parser.Max_lines {
+		mark := parser.Mark
+		parser.Lines_mark = &mark
+	}
+}
+
 // Advance the buffer pointer.
 func skip(parser *YamlParser) {
+	checkChar(parser)
 	if !yamlh.Is_blank(parser.Buffer, parser.Buffer_pos) {
 		parser.Newlines = 0
 	}
@@ -552,6 +566,7 @@ func skip_line(parser *YamlParser) {
 
 // Copy a character to a string buffer and advance pointers.
 func read(parser *YamlParser, s []byte) []byte {
+	checkChar(parser)
 	if !yamlh.Is_blank(parser.Buffer, parser.Buffer_pos) {
 		parser.Newlines = 0
 	}
@@ -612,7 +627,7 @@ func read_line(parser *YamlParser, s []byte) []byte {
 
 // Set the scanner error and return the error.
 func newScannerError(parser *YamlParser, context_mark yamlh.Position, problem string) error {
-	return buildParserError(yamlh.SCANNER_ERROR, problem, parser.Mark.Line, context_mark.Line)
+	return buildParserError(yamlh.SCANNER_ERROR, problem, parser.Mark, context_mark)
 }
 
 // Ensure that the tokens queue contains at least one token which can be
@@ -644,6 +659,13 @@ func yaml_parser_fetch_more_tokens(parser *YamlParser) error {
 		if err != nil {
 			return err
 		}
+		if parser.Tab_mark != nil {
+			return yamlh.NewSyntaxError(yamlh.SCANNER_ERROR, *parser.Tab_mark, parser.Tab_mark.Line+1, "found a tab character")
+		}
+		if parser.Lines_mark != nil {
+			problem := fmt.Sprintf("input exceeds the maximum of %d lines", parser.Max_lines)
+			return yamlh.NewSyntaxError(yamlh.SCANNER_ERROR, *parser.Lines_mark, parser.Lines_mark.Line+1, problem)
+		}
 	}
 
 	parser.Token_available = true
@@ -818,7 +840,7 @@ func yaml_simple_key_is_valid(parser *YamlParser, simple_key *yamlh.SimpleKey) (
 	//
 	if simple_key.Mark.Line < parser.Mark.Line || simple_key.Mark.Index+1024 < parser.Mark.Index {
 		// Check if the potential simple key to be removed is required.
-		if simple_key.Required {
+		if simple_key.Required && !recoverSimpleKey(parser, simple_key) {
 			return false, newScannerError(parser, simple_key.Mark, "could not find expected ':'")
 		}
 		simple_key.Possible = false
@@ -840,17 +862,18 @@ func yaml_parser_save_simple_key(parser *YamlParser) error {
 	// If the current position may start a simple key, save it.
 	//
 	if parser.Simple_key_allowed {
+		// Removing the previous key may drop tokens when recovering from
+		// errors, so it must be done before numbering the new one.
+		err := yaml_parser_remove_simple_key(parser)
+		if err != nil {
+			return err
+		}
 		simple_key := yamlh.SimpleKey{
 			Possible:     true,
 			Required:     required,
 			Token_number: parser.Tokens_parsed + (len(parser.Tokens) - parser.Tokens_head),
 			Mark:         parser.Mark,
 		}
-
-		err := yaml_parser_remove_simple_key(parser)
-		if err != nil {
-			return err
-		}
 		parser.Simple_keys[len(parser.Simple_keys)-1] = simple_key
 		parser.Simple_keys_by_tok[simple_key.Token_number] = len(parser.Simple_keys) - 1
 	}
@@ -862,7 +885,7 @@ func yaml_parser_remove_simple_key(parser *YamlParser) error {
 	i := len(parser.Simple_keys) - 1
 	if parser.Simple_keys[i].Possible {
 		// If the key is required, it is an error.
-		if parser.Simple_keys[i].Required {
+		if parser.Simple_keys[i].Required && !recoverSimpleKey(parser, &parser.Simple_keys[i]) {
 			return newScannerError(parser, parser.Simple_keys[i].Mark, "could not find expected ':'")
 		}
 		// Remove the key from the stack.
@@ -872,6 +895,40 @@ func yaml_parser_remove_simple_key(parser *YamlParser) error {
 	return nil
 }
 
+// recoverSimpleKey drops the tokens of the line of a required simple key that
+// is not followed by ':' on that line, when error recovery is enabled, and
+// records a warning. It reports whether the key was recovered from.
+func recoverSimpleKey(parser *YamlParser, simple_key *yamlh.SimpleKey) bool {
+	if !parser.Error_recovery || simple_key.Mark.Line >= parser.Mark.Line {
+		return false
+	}
+	start := parser.Tokens_head + simple_key.Token_number - parser.Tokens_parsed
+	if start < parser.Tokens_head {
+		return false
+	}
+	end := start
+	for end < len(parser.Tokens) && parser.Tokens[end].Start_mark.Line == simple_key.Mark.Line {
+		end++
+	}
+	parser.Tokens = append(parser.Tokens[:start], parser.Tokens[end:]...)
+	simple_key.Possible = false
+	delete(parser.Simple_keys_by_tok, simple_key.Token_number)
+
+	// Renumber the keys saved after the dropped tokens.
+	for i := range parser.Simple_keys {
+		key := &parser.Simple_keys[i]
+		if key.Possible && key.Token_number > simple_key.Token_number {
+			delete(parser.Simple_keys_by_tok, key.Token_number)
+			key.Token_number -= end - start
+			parser.Simple_keys_by_tok[key.Token_number] = i
+		}
+	}
+
+	warning := yamlh.NewSyntaxError(yamlh.SCANNER_ERROR, simple_key.Mark, simple_key.Mark.Line+1, "could not find expected ':'")
+	parser.Warnings = append(parser.Warnings, *warning)
+	return true
+}
+
 // max_flow_level limits the flow_level
 const max_flow_level = 10000
 
@@ -1441,6 +1498,39 @@ func yaml_parser_fetch_plain_scalar(parser *YamlParser) error {
 	return nil
 }
 
+// yaml_parser_tab_separates_indicator reports whether the tab at the
+// current position follows the '?' or ':' indicator of an explicit key or
+// value on the same line, and precedes a node that is not a compact block
+// collection, so it may be skipped as separation as in "?\ta" or ":\t1".
+func yaml_parser_tab_separates_indicator(parser *YamlParser) (bool, error) {
+	if len(parser.Tokens) == 0 {
+		return false, nil
+	}
+	last := &parser.Tokens[len(parser.Tokens)-1]
+	if (last.Type != yamlh.KEY_TOKEN && last.Type != yamlh.VALUE_TOKEN) || last.End_mark.Line != parser.Mark.Line {
+		return false, nil
+	}
+	i := 0
+	for {
+		if parser.Unread < i+2 {
+			err := yaml_parser_update_buffer(parser, i+2)
+			if err != nil {
+				return false, err
+			}
+		}
+		if !yamlh.Is_blank(parser.Buffer, parser.Buffer_pos+i) {
+			break
+		}
+		i++
+	}
+	pos := parser.Buffer_pos + i
+	switch parser.Buffer[pos] {
+	case '-', '?', ':':
+		return !yamlh.Is_blankz(parser.Buffer, pos+1), nil
+	}
+	return true, nil
+}
+
 // Eat whitespaces and comments until the next token is found.
 func yaml_parser_scan_to_next_token(parser *YamlParser) error {
 	scan_mark := parser.Mark
@@ -1470,7 +1560,16 @@ func yaml_parser_scan_to_next_token(parser *YamlParser) error {
 			}
 		}
 
-		for parser.Buffer[parser.Buffer_pos] == ' ' || ((parser.Flow_level > 0 || !parser.Simple_key_allowed) && parser.Buffer[parser.Buffer_pos] == '\t') {
+		for parser.Buffer[parser.Buffer_pos] == ' ' || parser.Buffer[parser.Buffer_pos] == '\t' {
+			if parser.Buffer[parser.Buffer_pos] == '\t' && parser.Flow_level == 0 && parser.Simple_key_allowed {
+				separates, err := yaml_parser_tab_separates_indicator(parser)
+				if err != nil {
+					return err
+				}
+				if !separates {
+					break
+				}
+			}
 			skip(parser)
 			if parser.Unread < 1 {
 				err := yaml_parser_update_buffer(parser, 1)
@@ -1853,6 +1952,10 @@ func yaml_parser_scan_tag_directive_value(parser *YamlParser, start_mark yamlh.P
 	return handle_value, prefix_value, nil
 }
 
+// default_max_anchor_len limits the length of anchor and alias names when
+// Max_anchor_len is not set.
+const default_max_anchor_len = 1024
+
 func yaml_parser_scan_anchor(parser *YamlParser, typ yamlh.TokenType) (*yamlh.YamlToken, error) {
 	var s []byte
 
@@ -1868,7 +1971,14 @@ func yaml_parser_scan_anchor(parser *YamlParser, typ yamlh.TokenType) (*yamlh.Ya
 		}
 	}
 
+	max_len := parser.Max_anchor_len
+	if max_len == 0 {
+		max_len = default_max_anchor_len
+	}
 	for yamlh.Is_alpha(parser.Buffer, parser.Buffer_pos) {
+		if max_len > 0 && len(s) == max_len {
+			return nil, newScannerError(parser, start_mark, fmt.Sprintf("found anchor name longer than %d characters", max_len))
+		}
 		s = read(parser, s)
 		if parser.Unread < 1 {
 			err := yaml_parser_update_buffer(parser, 1)
@@ -2575,6 +2685,31 @@ func yaml_parser_scan_flow_scalar(parser *YamlParser, single bool) (*yamlh.YamlT
 						value = (value << 4) + yamlh.As_hex(parser.Buffer, parser.Buffer_pos+k)
 					}
 
+					// [Go] Combine a UTF-16 surrogate pair written as two
+					//      \u escapes, as JSON does, into a single character.
+					if code_length == 4 && value >= 0xD800 && value <= 0xDBFF {
+						if parser.Unread < 10 {
+							err := yaml_parser_update_buffer(parser, 10)
+							if err != nil {
+								return nil, err
+							}
+						}
+						pos := parser.Buffer_pos + 4
+						if parser.Buffer[pos] == '\\' && parser.Buffer[pos+1] == 'u' {
+							low, ok := 0, true
+							for k := 2; k < 6 && ok; k++ {
+								ok = yamlh.Is_hex(parser.Buffer, pos+k)
+								if ok {
+									low = (low << 4) + yamlh.As_hex(parser.Buffer, pos+k)
+								}
+							}
+							if ok && low >= 0xDC00 && low <= 0xDFFF {
+								value = 0x10000 + (value-0xD800)<<10 + (low - 0xDC00)
+								code_length += 6
+							}
+						}
+					}
+
 					// Check the value and write the character.
 					if (value >= 0xD800 && value <= 0xDFFF) || value > 0x10FFFF {
 						return nil, newScannerError(parser, start_mark, "found invalid Unicode character escape code")
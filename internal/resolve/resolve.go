@@ -82,6 +82,7 @@ const (
 	TimestampTag = "!!timestamp"
 	SeqTag       = "!!seq"
 	MapTag       = "!!map"
+	SetTag       = "!!set"
 	BinaryTag    = "!!binary"
 	MergeTag     = "!!merge"
 )
@@ -301,7 +302,7 @@ var allowedTimestampFormats = []string{
 	"2006-1-2 15:4:5.999999999",       // space separated with no time zone
 	"2006-1-2",                        // date only
 	// Notable exception: time.Parse cannot handle: "2001-12-14 21:59:43.10 -5"
-	// from the set of examples.
+	// from the set of examples. That form is handled by parseSpacedTimestamp.
 }
 
 // parseTimestamp parses s as a timestamp string and
@@ -326,5 +327,51 @@ func parseTimestamp(s string) (time.Time, bool) {
 			return t, true
 		}
 	}
-	return time.Time{}, false
+	return parseSpacedTimestamp(s)
+}
+
+// spacedTimestamp matches the timestamp forms from http://yaml.org/type/timestamp.html
+// that time.Parse cannot handle: arbitrary whitespace between the date, time and
+// zone fields, and numeric zone offsets with an optional minutes part.
+var spacedTimestamp = regexp.MustCompile(`^(\d{4})-(\d\d?)-(\d\d?)(?:[Tt]|[ \t]+)(\d\d?):(\d\d):(\d\d)(?:\.(\d*))?(?:[ \t]*(Z|([-+])(\d\d?)(?::(\d\d))?))?$`)
+
+// parseSpacedTimestamp parses s using spacedTimestamp. Timestamps without a
+// time zone are assumed to be in UTC.
+func parseSpacedTimestamp(s string) (time.Time, bool) {
+	m := spacedTimestamp.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	year, month, day := atoi(m[1]), atoi(m[2]), atoi(m[3])
+	hour, minute, sec := atoi(m[4]), atoi(m[5]), atoi(m[6])
+	nsec := 0
+	if frac := m[7]; frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		nsec = atoi(frac + strings.Repeat("0", 9-len(frac)))
+	}
+	loc := time.UTC
+	if m[8] != "" && m[8] != "Z" {
+		offset := atoi(m[10])*60*60 + atoi(m[11])*60
+		if m[9] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, sec, nsec, loc)
+	// Reject out of range fields that time.Date would otherwise normalize.
+	if t.Month() != time.Month(month) || t.Day() != day || t.Hour() != hour || t.Minute() != minute || t.Second() != sec {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// atoi converts a string of ASCII digits to an int.
+func atoi(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n = n*10 + int(s[i]-'0')
+	}
+	return n
 }
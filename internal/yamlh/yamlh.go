@@ -74,6 +74,37 @@ const (
 	EMITTER_ERROR // Cannot emit a YAML stream.
 )
 
+// SyntaxError describes input that could not be read, scanned or parsed.
+type SyntaxError struct {
+	Kind    ErrorType // READER_ERROR, SCANNER_ERROR or PARSER_ERROR.
+	Line    int       // The line of the problem, starting at 1. 0 when unknown.
+	Column  int       // The column of the problem, starting at 1. 0 when unknown.
+	Problem string
+
+	// messageLine is the line reported in the message, or 0 for none. It
+	// differs from Line where the messages of yaml.v3 do.
+	messageLine int
+}
+
+// NewSyntaxError returns a SyntaxError of kind for a problem at mark, whose
+// message reports messageLine, or no line when it is 0.
+func NewSyntaxError(kind ErrorType, mark Position, messageLine int, problem string) *SyntaxError {
+	return &SyntaxError{
+		Kind:        kind,
+		Line:        mark.Line + 1,
+		Column:      mark.Column + 1,
+		Problem:     problem,
+		messageLine: messageLine,
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	if e.messageLine == 0 {
+		return "yaml: " + e.Problem
+	}
+	return fmt.Sprintf("yaml: line %d: %s", e.messageLine, e.Problem)
+}
+
 // Position is he pointer position.
 type Position struct {
 	Index  int // The position Index.
@@ -295,6 +326,9 @@ type Event struct {
 	Foot_comment []byte
 	Tail_comment []byte
 
+	// The number of blank lines before a block mapping key.
+	Blank_lines int
+
 	// The Anchor (for SCALAR_EVENT, SEQUENCE_START_EVENT, MAPPING_START_EVENT, ALIAS_EVENT).
 	Anchor []byte
 
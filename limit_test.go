@@ -1,6 +1,7 @@
 package yaml_test
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
@@ -138,3 +139,132 @@ func benchmark(b *testing.B, name string) {
 
 	b.Errorf("testcase %q not found", name)
 }
+
+func TestDecoderMaxMapEntries(t *testing.T) {
+	data := "a: 1\nb: 2\nc:\n  d: 3\n  e: 4\n"
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxMapEntries(3)
+	var v map[string]interface{}
+	require.NoError(t, dec.Decode(&v))
+
+	dec = yaml.NewDecoder(strings.NewReader("x: 0\n" + data))
+	dec.SetMaxMapEntries(3)
+	require.EqualError(t, dec.Decode(&v), "yaml: line 1: mapping exceeds the maximum of 3 entries")
+
+	dec = yaml.NewDecoder(strings.NewReader(data + "---\n" + data))
+	dec.SetMaxDocumentMapEntries(5)
+	require.NoError(t, dec.Decode(&v))
+	require.NoError(t, dec.Decode(&v))
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxDocumentMapEntries(4)
+	require.EqualError(t, dec.Decode(&v), "yaml: document exceeds the maximum of 4 mapping entries")
+}
+
+func TestDecoderMaxLines(t *testing.T) {
+	data := "a: 1\nb: |\n  x\n  y\nc: [1,\n  2]\n"
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxLines(6)
+	var v map[string]interface{}
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{"a": 1, "b": "x\ny\n", "c": []interface{}{1, 2}}, v)
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxLines(5)
+	require.EqualError(t, dec.Decode(&v), "yaml: line 6: input exceeds the maximum of 5 lines")
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxLines(3)
+	require.EqualError(t, dec.Decode(&v), "yaml: line 4: input exceeds the maximum of 3 lines")
+
+	dec = yaml.NewDecoder(strings.NewReader(data + "---\n" + data))
+	dec.SetMaxLines(8)
+	require.NoError(t, dec.Decode(&v))
+	require.EqualError(t, dec.Decode(&v), "yaml: line 9: input exceeds the maximum of 8 lines")
+}
+
+func TestDecoderMaxAnchorNameLen(t *testing.T) {
+	data := "a: &short 1\nb: &abcdefgh [*short]\n"
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxAnchorNameLen(8)
+	var v map[string]interface{}
+	require.NoError(t, dec.Decode(&v))
+	require.Equal(t, map[string]interface{}{"a": 1, "b": []interface{}{1}}, v)
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxAnchorNameLen(7)
+	require.EqualError(t, dec.Decode(&v), "yaml: line 2: found anchor name longer than 7 characters")
+
+	// Aliases are limited as well.
+	dec = yaml.NewDecoder(strings.NewReader("a: &abcd 1\nb: *abcde\n"))
+	dec.SetMaxAnchorNameLen(4)
+	require.EqualError(t, dec.Decode(&v), "yaml: line 2: found anchor name longer than 4 characters")
+
+	// The default limit is generous, but still bounds the names.
+	long := strings.Repeat("x", 1024)
+	require.NoError(t, yaml.Unmarshal([]byte("a: 1\nb: &"+long+" 2\nc: *"+long+"\n"), &v))
+	require.EqualError(t, yaml.Unmarshal([]byte("a: 1\nb: &"+long+"x 2\n"), &v), "yaml: line 2: found anchor name longer than 1024 characters")
+
+	// A negative value removes the limit.
+	dec = yaml.NewDecoder(strings.NewReader("a: 1\nb: &" + long + "x 2\n"))
+	dec.SetMaxAnchorNameLen(-1)
+	var unlimited map[string]interface{}
+	require.NoError(t, dec.Decode(&unlimited))
+	require.Equal(t, map[string]interface{}{"a": 1, "b": 2}, unlimited)
+}
+
+func TestEncoderMaxDepth(t *testing.T) {
+	encode := func(v interface{}, depth int) (string, error) {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetMaxDepth(depth)
+		err := enc.Encode(v)
+		if err != nil {
+			return "", err
+		}
+		err = enc.Close()
+		return buf.String(), err
+	}
+
+	nested := &yaml.Node{Kind: yaml.ScalarNode, Value: "x"}
+	for i := 0; i < 3; i++ {
+		nested = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{nested}}
+	}
+	out, err := encode(nested, 3)
+	require.NoError(t, err)
+	require.Equal(t, "- - - x\n", out)
+	_, err = encode(nested, 2)
+	require.EqualError(t, err, "yaml: node exceeds the maximum depth of 2")
+
+	cyclic := &yaml.Node{Kind: yaml.MappingNode}
+	cyclic.Content = []*yaml.Node{{Kind: yaml.ScalarNode, Value: "a"}, cyclic}
+	_, err = encode(cyclic, 100)
+	require.EqualError(t, err, "yaml: node exceeds the maximum depth of 100")
+
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte("a:\n  b:\n    - c\n"), &doc))
+	_, err = encode(&doc, 2)
+	require.EqualError(t, err, "yaml: line 3, column 5: node exceeds the maximum depth of 2")
+}
+
+func TestEncoderMaxDepthGoValues(t *testing.T) {
+	encode := func(v interface{}, depth int) error {
+		enc := yaml.NewEncoder(&bytes.Buffer{})
+		enc.SetMaxDepth(depth)
+		return enc.Encode(v)
+	}
+
+	v := map[string]interface{}{"a": []interface{}{map[string]int{"b": 1}}}
+	require.NoError(t, encode(v, 3))
+	require.EqualError(t, encode(v, 2), "yaml: node exceeds the maximum depth of 2")
+
+	type list struct {
+		Next *list
+	}
+	l := &list{}
+	l.Next = l
+	require.EqualError(t, encode(l, 100), "yaml: node exceeds the maximum depth of 100")
+}
@@ -0,0 +1,125 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// LintOptions configures Lint.
+type LintOptions struct {
+	// Indent is the number of spaces each nested block mapping or sequence
+	// is expected to be indented by. When 0, the first indentation step
+	// found in the data is used as the expectation for the rest of it.
+	Indent int
+}
+
+// LintIssue is a style problem reported by Lint.
+type LintIssue struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("line %d, column %d: %s", i.Line, i.Column, i.Message)
+}
+
+// Lint checks the style of the YAML documents in data and returns the issues
+// found, in the order they appear. It reports:
+//
+//   - block collections whose indentation step differs from the others
+//   - trailing whitespace
+//   - tabs in the indentation of a line
+//
+// Lint does not validate data. If data cannot be parsed, the indentation
+// steps are only checked up to the failing document and the parse error is
+// reported as an issue at line 0.
+func Lint(data []byte, opts LintOptions) []LintIssue {
+	var issues []LintIssue
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		indent := len(line) - len(bytes.TrimLeft(line, " \t"))
+		if tab := bytes.IndexByte(line[:indent], '\t'); tab >= 0 {
+			issues = append(issues, LintIssue{Line: i + 1, Column: tab + 1, Message: "tab in indentation"})
+		}
+		trimmed := len(bytes.TrimRight(line, " \t"))
+		if trimmed < len(line) {
+			issues = append(issues, LintIssue{Line: i + 1, Column: trimmed + 1, Message: "trailing whitespace"})
+		}
+	}
+
+	l := linter{indent: opts.Indent}
+	p := newParser(bytes.NewReader(data))
+	for {
+		node, err := p.Parse()
+		if err != nil {
+			l.issues = append(l.issues, LintIssue{Message: err.Error()})
+			break
+		}
+		if node == nil {
+			break
+		}
+		l.node(node)
+	}
+	issues = append(issues, l.issues...)
+	sort.SliceStable(issues, func(i, j int) bool {
+		x, y := issues[i], issues[j]
+		if x.Line == 0 || y.Line == 0 {
+			return y.Line == 0 && x.Line != 0
+		}
+		return x.Line < y.Line || x.Line == y.Line && x.Column < y.Column
+	})
+	return issues
+}
+
+type linter struct {
+	indent int
+	issues []LintIssue
+}
+
+func (l *linter) node(n *Node) {
+	if n.Style&FlowStyle != 0 {
+		return
+	}
+	switch n.Kind {
+	case DocumentNode, SequenceNode:
+		for _, c := range n.Content {
+			l.node(c)
+		}
+	case MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			l.step(key, value)
+			l.node(key)
+			l.node(value)
+		}
+	}
+}
+
+// step checks the indentation of a block collection that starts on the
+// line after its key.
+func (l *linter) step(key, value *Node) {
+	if value.Kind != MappingNode && value.Kind != SequenceNode || value.Style&FlowStyle != 0 {
+		return
+	}
+	if value.Line <= key.Line {
+		return
+	}
+	step := value.Column - key.Column
+	if step == 0 && value.Kind == SequenceNode {
+		// An indentless sequence is always allowed.
+		return
+	}
+	if l.indent == 0 && step > 0 {
+		l.indent = step
+		return
+	}
+	if step != l.indent {
+		l.issues = append(l.issues, LintIssue{
+			Line:    value.Line,
+			Column:  value.Column,
+			Message: fmt.Sprintf("inconsistent indentation: expected %d spaces, found %d", l.indent, step),
+		})
+	}
+}
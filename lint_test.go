@@ -0,0 +1,65 @@
+package yaml_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/yaml"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		opts   yaml.LintOptions
+		issues []yaml.LintIssue
+	}{
+		{
+			name: "clean",
+			data: "a:\n  b:\n    c: 1\n  d:\n  - 1\n  - e:\n      f: 2\n",
+		},
+		{
+			name: "mixed steps",
+			data: "a:\n  b: 1\nc:\n    d:\n      e: 1\n",
+			issues: []yaml.LintIssue{
+				{Line: 4, Column: 5, Message: "inconsistent indentation: expected 2 spaces, found 4"},
+			},
+		},
+		{
+			name: "configured step",
+			data: "a:\n  b:\n    - 1\n",
+			opts: yaml.LintOptions{Indent: 4},
+			issues: []yaml.LintIssue{
+				{Line: 2, Column: 3, Message: "inconsistent indentation: expected 4 spaces, found 2"},
+				{Line: 3, Column: 5, Message: "inconsistent indentation: expected 4 spaces, found 2"},
+			},
+		},
+		{
+			name: "flow collections are skipped",
+			data: "a:\n  b: {c: 1,\n        d: 2}\n",
+		},
+		{
+			name: "trailing whitespace and tabs",
+			data: "a: 1 \nb: [1,\n \t2]\nc: 3\t\n",
+			issues: []yaml.LintIssue{
+				{Line: 1, Column: 5, Message: "trailing whitespace"},
+				{Line: 3, Column: 2, Message: "tab in indentation"},
+				{Line: 4, Column: 5, Message: "trailing whitespace"},
+			},
+		},
+		{
+			name: "parse error",
+			data: "a: 1 \nb: [\n",
+			issues: []yaml.LintIssue{
+				{Line: 1, Column: 5, Message: "trailing whitespace"},
+				{Message: "yaml: line 2: did not find expected node content"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issues := yaml.Lint([]byte(test.data), test.opts)
+			require.Equal(t, test.issues, issues)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package yaml
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SequenceMergeMode selects how MergeDocumentsWith merges a sequence in the
+// overlay with a sequence under the same key in the base.
+type SequenceMergeMode int
+
+const (
+	// ReplaceSequences uses the overlay sequence in place of the base one.
+	ReplaceSequences SequenceMergeMode = iota
+	// AppendSequences appends the items of the overlay sequence to the
+	// items of the base one.
+	AppendSequences
+)
+
+// MergeDocuments deep merges overlay over base and returns the result as a
+// new tree, leaving both arguments unchanged. It is meant for layered
+// configuration and is unrelated to the "<<" merge key.
+//
+// Mappings are merged key by key: keys only in one of the two are kept, and
+// for keys in both, nested mappings are merged in turn while any other value
+// in the overlay replaces the one in the base, including sequences. Keys
+// keep their position in the base, and keys only in the overlay are added
+// after them. Comments in the base are kept unless overridden, and a
+// replaced value that has no comments of its own keeps the ones of the value
+// it replaces.
+//
+// Either argument may be a document node, in which case its content is
+// merged and the result is a document if base is. An error is returned if
+// the result would hold an alias to an anchored node the overlay replaced.
+func MergeDocuments(base, overlay *Node) (*Node, error) {
+	return MergeDocumentsWith(base, overlay, ReplaceSequences)
+}
+
+// MergeDocumentsWith is like MergeDocuments, with sequences present in both
+// base and overlay merged as selected by mode.
+func MergeDocumentsWith(base, overlay *Node, mode SequenceMergeMode) (*Node, error) {
+	if base == nil || overlay == nil {
+		return nil, errors.New("yaml: cannot merge a nil node")
+	}
+	m := merger{mode: mode, copies: make(map[*Node]*Node)}
+	var merged *Node
+	switch {
+	case base.Kind == DocumentNode && len(base.Content) == 1:
+		merged = m.copyShallow(base)
+		merged.Content = []*Node{m.merge(base.Content[0], documentContent(overlay))}
+	case base.Kind == DocumentNode && len(base.Content) == 0:
+		merged = m.copyShallow(base)
+		merged.Content = []*Node{m.copy(documentContent(overlay))}
+	default:
+		merged = m.merge(base, documentContent(overlay))
+	}
+	if err := checkMergedAliases(merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// documentContent returns the root of document n, or n itself if it is not
+// a document.
+func documentContent(n *Node) *Node {
+	if n.Kind == DocumentNode && len(n.Content) == 1 {
+		return n.Content[0]
+	}
+	return n
+}
+
+type merger struct {
+	mode   SequenceMergeMode
+	copies map[*Node]*Node
+}
+
+func (m *merger) merge(base, overlay *Node) *Node {
+	switch {
+	case base.Kind == MappingNode && overlay.Kind == MappingNode:
+		merged := m.copy(base)
+		keys := indexMappingKeys(merged)
+		for i := 0; i+1 < len(overlay.Content); i += 2 {
+			key, value := overlay.Content[i], overlay.Content[i+1]
+			j := keys.find(merged, key)
+			if j < 0 {
+				keys.add(key, len(merged.Content))
+				merged.Content = append(merged.Content, m.copy(key), m.copy(value))
+				continue
+			}
+			// Merge with the value in base rather than its copy, so the
+			// copy is found in m.copies and updated in place.
+			from := base.Content
+			if j >= len(from) {
+				from = merged.Content
+			}
+			merged.Content[j+1] = m.merge(from[j+1], value)
+		}
+		return merged
+	case base.Kind == SequenceNode && overlay.Kind == SequenceNode && m.mode == AppendSequences:
+		merged := m.copy(base)
+		for _, item := range overlay.Content {
+			merged.Content = append(merged.Content, m.copy(item))
+		}
+		return merged
+	}
+	merged := m.copy(overlay)
+	if merged.HeadComment == "" && merged.LineComment == "" && merged.FootComment == "" {
+		merged.HeadComment = base.HeadComment
+		merged.LineComment = base.LineComment
+		merged.FootComment = base.FootComment
+	}
+	return merged
+}
+
+func (m *merger) copyShallow(n *Node) *Node {
+	c := *n
+	c.Content = nil
+	m.copies[n] = &c
+	return &c
+}
+
+// copy returns a deep copy of n. Nodes reached more than once, as the
+// targets of aliases are, are copied only once so aliases in the copy refer
+// to the copied nodes.
+func (m *merger) copy(n *Node) *Node {
+	if c, ok := m.copies[n]; ok {
+		return c
+	}
+	c := m.copyShallow(n)
+	if n.Alias != nil {
+		c.Alias = m.copy(n.Alias)
+	}
+	if n.Content != nil {
+		c.Content = make([]*Node, len(n.Content))
+		for i, item := range n.Content {
+			c.Content[i] = m.copy(item)
+		}
+	}
+	return c
+}
+
+// checkMergedAliases returns an error if an alias in the tree rooted at n
+// refers to a node that is not part of the tree.
+func checkMergedAliases(n *Node) error {
+	inTree := make(map[*Node]bool)
+	var aliases []*Node
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Kind == AliasNode {
+			aliases = append(aliases, n)
+			return
+		}
+		inTree[n] = true
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(n)
+	for _, a := range aliases {
+		if a.Alias != nil && !inTree[a.Alias] {
+			return fmt.Errorf("yaml: merged document has alias *%s to a node replaced by the overlay", a.Value)
+		}
+	}
+	return nil
+}
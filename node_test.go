@@ -1121,13 +1121,14 @@ var nodeTests = []struct {
 					Value:       "va",
 					LineComment: "# IA",
 				}, {
-					Kind:        yaml.ScalarNode,
-					Line:        13,
-					Column:      1,
-					Tag:         "!!str",
-					Value:       "kb",
-					HeadComment: "# HB1\n# HB2",
-					FootComment: "# FB1\n# FB2",
+					Kind:             yaml.ScalarNode,
+					Line:             13,
+					Column:           1,
+					Tag:              "!!str",
+					Value:            "kb",
+					BlankLinesBefore: 1,
+					HeadComment:      "# HB1\n# HB2",
+					FootComment:      "# FB1\n# FB2",
 				}, {
 					Kind:        yaml.ScalarNode,
 					Line:        13,
@@ -1548,13 +1549,14 @@ var nodeTests = []struct {
 						}},
 					}},
 				}, {
-					Kind:        yaml.ScalarNode,
-					Tag:         "!!str",
-					Value:       "ke",
-					HeadComment: "# HE1\n# HE2",
-					FootComment: "# FE1\n# FE2",
-					Line:        28,
-					Column:      1,
+					Kind:             yaml.ScalarNode,
+					Tag:              "!!str",
+					Value:            "ke",
+					BlankLinesBefore: 1,
+					HeadComment:      "# HE1\n# HE2",
+					FootComment:      "# FE1\n# FE2",
+					Line:             28,
+					Column:           1,
 				}, {
 					Kind:   yaml.ScalarNode,
 					Tag:    "!!str",
@@ -1903,11 +1905,12 @@ var nodeTests = []struct {
 						Column: 7,
 					}},
 				}, {
-					Kind:   yaml.ScalarNode,
-					Tag:    "!!str",
-					Value:  "kc",
-					Line:   5,
-					Column: 1,
+					Kind:             yaml.ScalarNode,
+					Tag:              "!!str",
+					Value:            "kc",
+					BlankLinesBefore: 1,
+					Line:             5,
+					Column:           1,
 				}, {
 					Kind:   yaml.ScalarNode,
 					Tag:    "!!str",
@@ -1969,8 +1972,7 @@ var nodeTests = []struct {
 			}},
 		},
 	}, {
-		// Decode only due to empty line before HC1.
-		yaml: "[decode]ka:\n  kb: vb\n\n# HC1\nkc: vc\n",
+		yaml: "ka:\n  kb: vb\n\n# HC1\nkc: vc\n",
 		node: yaml.Node{
 			Kind:   yaml.DocumentNode,
 			Line:   1,
@@ -2005,12 +2007,13 @@ var nodeTests = []struct {
 						Column: 7,
 					}},
 				}, {
-					Kind:        yaml.ScalarNode,
-					Tag:         "!!str",
-					Value:       "kc",
-					HeadComment: "# HC1",
-					Line:        5,
-					Column:      1,
+					Kind:             yaml.ScalarNode,
+					Tag:              "!!str",
+					Value:            "kc",
+					BlankLinesBefore: 1,
+					HeadComment:      "# HC1",
+					Line:             5,
+					Column:           1,
 				}, {
 					Kind:   yaml.ScalarNode,
 					Tag:    "!!str",
@@ -2021,8 +2024,7 @@ var nodeTests = []struct {
 			}},
 		},
 	}, {
-		// Decode-only due to empty lines around HC1.
-		yaml: "[decode]ka:\n  kb: vb\n\n# HC1\n\nkc: vc\n",
+		yaml: "ka:\n  kb: vb\n\n# HC1\n\nkc: vc\n",
 		node: yaml.Node{
 			Kind:   yaml.DocumentNode,
 			Line:   1,
@@ -2057,12 +2059,13 @@ var nodeTests = []struct {
 						Column: 7,
 					}},
 				}, {
-					Kind:        yaml.ScalarNode,
-					Tag:         "!!str",
-					Value:       "kc",
-					HeadComment: "# HC1\n",
-					Line:        6,
-					Column:      1,
+					Kind:             yaml.ScalarNode,
+					Tag:              "!!str",
+					Value:            "kc",
+					BlankLinesBefore: 1,
+					HeadComment:      "# HC1\n",
+					Line:             6,
+					Column:           1,
 				}, {
 					Kind:   yaml.ScalarNode,
 					Tag:    "!!str",
@@ -2167,8 +2170,8 @@ var nodeTests = []struct {
 			}},
 		},
 	}, {
-		// Same as above, but decode only due to empty line between ka's value and kc's headers.
-		yaml: "[decode]# HA1\nka:\n  # HB1\n  kb: vb\n  # FB1\n\n# HC1\n# HC2\nkc: vc\n# FC1\n# FC2\n",
+		// Same as above, with comments on both sides of the empty line.
+		yaml: "# HA1\nka:\n  # HB1\n  kb: vb\n  # FB1\n\n# HC1\n# HC2\nkc: vc\n# FC1\n# FC2\n",
 		node: yaml.Node{
 			Kind:   yaml.DocumentNode,
 			Line:   2,
@@ -2206,13 +2209,14 @@ var nodeTests = []struct {
 						Column: 7,
 					}},
 				}, {
-					Kind:        yaml.ScalarNode,
-					Tag:         "!!str",
-					Value:       "kc",
-					HeadComment: "# HC1\n# HC2",
-					FootComment: "# FC1\n# FC2",
-					Line:        9,
-					Column:      1,
+					Kind:             yaml.ScalarNode,
+					Tag:              "!!str",
+					Value:            "kc",
+					BlankLinesBefore: 1,
+					HeadComment:      "# HC1\n# HC2",
+					FootComment:      "# FC1\n# FC2",
+					Line:             9,
+					Column:           1,
 				}, {
 					Kind:   yaml.ScalarNode,
 					Tag:    "!!str",
@@ -2681,6 +2685,40 @@ var setStringTests = []struct {
 	},
 }
 
+func TestNodeShortTag(t *testing.T) {
+	tests := []struct {
+		node yaml.Node
+		tag  string
+	}{
+		{yaml.Node{Kind: yaml.ScalarNode, Value: "80"}, "!!int"},
+		{yaml.Node{Kind: yaml.ScalarNode, Value: "1.5"}, "!!float"},
+		{yaml.Node{Kind: yaml.ScalarNode, Value: "true"}, "!!bool"},
+		{yaml.Node{Kind: yaml.ScalarNode, Value: "~"}, "!!null"},
+		{yaml.Node{Kind: yaml.ScalarNode, Value: "web"}, "!!str"},
+		{yaml.Node{Kind: yaml.ScalarNode, Value: "80", Style: yaml.DoubleQuotedStyle}, "!!str"},
+		{yaml.Node{Kind: yaml.ScalarNode, Value: "80", Tag: "tag:yaml.org,2002:str"}, "!!str"},
+		{yaml.Node{Kind: yaml.MappingNode}, "!!map"},
+		{yaml.Node{Kind: yaml.SequenceNode}, "!!seq"},
+		{yaml.Node{Kind: yaml.AliasNode, Alias: &yaml.Node{Kind: yaml.ScalarNode, Value: "1"}}, "!!int"},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.tag, test.node.ShortTag(), test.node.Value)
+	}
+}
+
+func TestCanonicalTag(t *testing.T) {
+	for _, name := range []string{"null", "bool", "str", "int", "float", "timestamp", "seq", "map", "binary", "merge"} {
+		long := yaml.CanonicalTag("!!" + name)
+		require.Equal(t, "tag:yaml.org,2002:"+name, long)
+		require.Equal(t, long, yaml.CanonicalTag(long))
+		node := yaml.Node{Kind: yaml.ScalarNode, Tag: long}
+		require.Equal(t, "!!"+name, node.ShortTag())
+	}
+	require.Equal(t, "!custom", yaml.CanonicalTag("!custom"))
+	require.Equal(t, "tag:example.com,2000:app/foo", yaml.CanonicalTag("tag:example.com,2000:app/foo"))
+	require.Equal(t, "", yaml.CanonicalTag(""))
+}
+
 func TestSetString(t *testing.T) {
 	for i, item := range setStringTests {
 		t.Run(fmt.Sprintf("%d: %q", i, item.str), func(t *testing.T) {
@@ -2827,3 +2865,469 @@ func TestNodeOmitEmpty(t *testing.T) {
 	_, err = yaml.Marshal(&v)
 	require.Error(t, err)
 }
+
+func TestNodeSetComments(t *testing.T) {
+	key := &yaml.Node{}
+	key.SetString("a")
+	key.SetHeadComment("first", "", "# already prefixed\nsplit")
+	value := &yaml.Node{}
+	value.SetString("b")
+	value.SetLineComment("trailing\ncomment")
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, value}}
+	mapping.SetFootComment("the end")
+
+	require.Equal(t, "# first\n#\n# already prefixed\n# split", key.HeadComment)
+	require.Equal(t, "# trailing comment", value.LineComment)
+	require.Equal(t, "# the end", mapping.FootComment)
+
+	out, err := yaml.Marshal(mapping)
+	require.NoError(t, err)
+	require.Equal(t, "# first\n#\n# already prefixed\n# split\na: b # trailing comment\n\n# the end\n", string(out))
+
+	key.SetHeadComment()
+	value.SetLineComment("")
+	require.Equal(t, "", key.HeadComment)
+	require.Equal(t, "", value.LineComment)
+}
+
+func TestNodeSequenceItemComments(t *testing.T) {
+	item := func(value, comment string) *yaml.Node {
+		return &yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Value:       value,
+			HeadComment: "# head " + comment,
+			LineComment: "# line " + comment,
+			FootComment: "# foot " + comment,
+		}
+	}
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item("a", "a"), item("b", "b"), item("c", "c")}}
+	want := "# head a\n- a # line a\n# foot a\n\n# head b\n- b # line b\n# foot b\n\n# head c\n- c # line c\n# foot c\n"
+	out, err := yaml.Marshal(seq)
+	require.NoError(t, err)
+	require.Equal(t, want, string(out))
+
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal(out, &doc))
+	for i, n := range doc.Content[0].Content {
+		require.Equal(t, seq.Content[i].HeadComment, n.HeadComment)
+		require.Equal(t, seq.Content[i].LineComment, n.LineComment)
+		require.Equal(t, seq.Content[i].FootComment, n.FootComment)
+	}
+	out, err = yaml.Marshal(&doc)
+	require.NoError(t, err)
+	require.Equal(t, want, string(out))
+
+	// The comments of block collection items are written around the item
+	// rather than after the item that follows it.
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "k"}, {Kind: yaml.ScalarNode, Value: "v"}}}
+	mapping.HeadComment, mapping.LineComment, mapping.FootComment = "# head m", "# line m", "# foot m"
+	inner := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "x"}, {Kind: yaml.ScalarNode, Value: "y"}}}
+	inner.HeadComment, inner.LineComment, inner.FootComment = "# head s", "# line s", "# foot s"
+	seq.Content = []*yaml.Node{mapping, inner, item("c", "c")}
+	out, err = yaml.Marshal(seq)
+	require.NoError(t, err)
+	require.Equal(t, "# head m\n- # line m\n  k: v\n# foot m\n\n# head s\n- # line s\n  - x\n  - y\n# foot s\n\n# head c\n- c # line c\n# foot c\n", string(out))
+
+	out, err = yaml.Marshal(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "a"}, mapping, {Kind: yaml.ScalarNode, Value: "b"}, {Kind: yaml.ScalarNode, Value: "2"}}})
+	require.NoError(t, err)
+	require.Equal(t, "a: # line m\n    # head m\n    k: v\n# foot m\n\nb: 2\n", string(out))
+}
+
+func TestNodeInsertAt(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte("[a, c]"), &doc)
+	require.NoError(t, err)
+	seq := doc.Content[0]
+
+	b := &yaml.Node{}
+	b.SetString("b")
+	require.NoError(t, seq.InsertAt(1, b))
+	d := &yaml.Node{}
+	d.SetString("d")
+	require.NoError(t, seq.InsertAt(3, d))
+
+	var got []string
+	require.NoError(t, seq.Decode(&got))
+	require.Equal(t, []string{"a", "b", "c", "d"}, got)
+
+	require.EqualError(t, seq.InsertAt(5, b), "yaml: sequence index 5 out of range [0, 4]")
+	require.EqualError(t, seq.InsertAt(-1, b), "yaml: sequence index -1 out of range [0, 4]")
+	require.EqualError(t, b.InsertAt(0, d), "yaml: cannot insert sequence items into scalar node")
+	require.EqualError(t, seq.InsertAt(0, b, nil), "yaml: cannot insert a nil sequence item")
+	require.Len(t, seq.Content, 4)
+}
+
+func TestNodeInsertKeyAt(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte("a: 1\nc: 3\n"), &doc)
+	require.NoError(t, err)
+	m := doc.Content[0]
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: "b"}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Value: "2"}
+	require.NoError(t, m.InsertKeyAt(1, key, value))
+
+	out, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+	require.Equal(t, "a: 1\nb: 2\nc: 3\n", string(out))
+
+	require.EqualError(t, m.InsertKeyAt(4, key, value), "yaml: mapping index 4 out of range [0, 3]")
+	require.EqualError(t, m.InsertKeyAt(0, key, nil), "yaml: cannot insert a nil mapping key or value")
+	require.EqualError(t, doc.InsertKeyAt(0, key, value), "yaml: cannot insert mapping keys into document node")
+}
+
+func TestNodeRoot(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte("a: 1\n"), &doc)
+	require.NoError(t, err)
+	require.Equal(t, yaml.DocumentNode, doc.Kind)
+	require.Same(t, doc.Content[0], doc.Root())
+
+	m := doc.Content[0]
+	require.Same(t, m, m.Root())
+	require.Same(t, m.Content[1], m.Content[1].Root())
+
+	require.Nil(t, (&yaml.Node{Kind: yaml.DocumentNode}).Root())
+	require.Nil(t, (*yaml.Node)(nil).Root())
+}
+
+func TestNodeResolved(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte("a: &x {b: 1}\nc: *x\nd: 2\n"), &doc)
+	require.NoError(t, err)
+	m := doc.Content[0]
+	alias := m.Content[3]
+	require.Equal(t, yaml.AliasNode, alias.Kind)
+	require.Same(t, m.Content[1], alias.Resolved())
+	require.Same(t, m.Content[5], m.Content[5].Resolved())
+	require.Same(t, m, m.Resolved())
+
+	// Aliases to aliases are followed to the end of the chain.
+	target := &yaml.Node{Kind: yaml.ScalarNode, Value: "v", Anchor: "y"}
+	first := &yaml.Node{Kind: yaml.AliasNode, Value: "y", Alias: target}
+	second := &yaml.Node{Kind: yaml.AliasNode, Value: "z", Alias: first}
+	third := &yaml.Node{Kind: yaml.AliasNode, Value: "w", Alias: second}
+	require.Same(t, target, first.Resolved())
+	require.Same(t, target, third.Resolved())
+
+	unset := &yaml.Node{Kind: yaml.AliasNode, Value: "u"}
+	require.Same(t, unset, unset.Resolved())
+	require.Nil(t, (*yaml.Node)(nil).Resolved())
+
+	loop := &yaml.Node{Kind: yaml.AliasNode, Value: "l"}
+	loop.Alias = &yaml.Node{Kind: yaml.AliasNode, Value: "m", Alias: loop}
+	require.Nil(t, loop.Resolved())
+	loop.Alias = loop
+	require.Nil(t, loop.Resolved())
+}
+
+func TestNodeBlankLinesBefore(t *testing.T) {
+	data := "name: app\nversion: 1\n\n# Network\nhost: localhost\nport: 80\n\n\ndebug: true\nlog:\n    level: info\n\n    file: app.log\n\nusers: [a, b]\n"
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+	var blank []int
+	m := doc.Content[0]
+	for i := 0; i < len(m.Content); i += 2 {
+		blank = append(blank, m.Content[i].BlankLinesBefore)
+	}
+	require.Equal(t, []int{0, 0, 1, 0, 2, 0, 1}, blank)
+
+	// Only the keys of the top-level mapping are set.
+	require.Equal(t, 0, m.Content[11].Content[2].BlankLinesBefore)
+
+	out, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+	require.Equal(t, strings.Replace(data, "info\n\n", "info\n", 1), string(out))
+
+	// Keys of nested mappings get blank lines when set, but not the first one.
+	node := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "a", BlankLinesBefore: 1},
+		{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "b"},
+			{Kind: yaml.ScalarNode, Value: "1"},
+			{Kind: yaml.ScalarNode, Value: "c", BlankLinesBefore: 1},
+			{Kind: yaml.ScalarNode, Value: "2"},
+		}},
+		{Kind: yaml.ScalarNode, Value: "d", BlankLinesBefore: 1},
+		{Kind: yaml.ScalarNode, Value: "3"},
+	}}
+	out, err = yaml.Marshal(node)
+	require.NoError(t, err)
+	require.Equal(t, "a:\n    b: 1\n\n    c: 2\n\nd: 3\n", string(out))
+
+	// Empty lines after a head comment are not counted, and are kept.
+	for _, data := range []string{
+		"a: 1\n\n# x\n\nb: 2\n",
+		"a: 1\n\n# x\nb: 2\n",
+		"a: 1\n\n# x\n\n# y\n\nb: 2\n",
+	} {
+		doc = yaml.Node{}
+		require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+		require.Equal(t, 1, doc.Content[0].Content[2].BlankLinesBefore, data)
+		out, err = yaml.Marshal(&doc)
+		require.NoError(t, err)
+		require.Equal(t, data, string(out))
+	}
+
+	// The entries of a root mapping decoded one by one are not in the
+	// top-level mapping either.
+	dec := yaml.NewDecoder(strings.NewReader("a:\n    b: 1\n\n    c: 2\n"))
+	err = dec.DecodeMapping(func(key string, value *yaml.Node) error {
+		require.Equal(t, 0, value.Content[2].BlankLinesBefore)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+type lintKey struct{}
+
+func TestNodeExtra(t *testing.T) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte("a: 1\nb: [2, 3]\n"), &doc)
+	require.NoError(t, err)
+	want, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+
+	m := doc.Content[0]
+	require.Nil(t, m.Extra(lintKey{}))
+	m.SetExtra(lintKey{}, "checked")
+	m.Content[3].SetExtra(lintKey{}, []string{"short"})
+	m.Content[3].SetExtra("other", 1)
+	require.Equal(t, "checked", m.Extra(lintKey{}))
+	require.Equal(t, []string{"short"}, m.Content[3].Extra(lintKey{}))
+	require.Equal(t, 1, m.Content[3].Extra("other"))
+	require.Nil(t, m.Content[1].Extra(lintKey{}))
+
+	got, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(got))
+
+	var v map[string]interface{}
+	require.NoError(t, doc.Decode(&v))
+	require.Equal(t, map[string]interface{}{"a": 1, "b": []interface{}{2, 3}}, v)
+
+	m.SetExtra(lintKey{}, nil)
+	require.Nil(t, m.Extra(lintKey{}))
+}
+
+func TestNodeEncodeAnchoredCollections(t *testing.T) {
+	for _, data := range []string{
+		"a: &x {b: 1}\nc: *x\n",
+		"a: &x [1, 2]\nc: *x\n",
+		"a: &x\n    b: 1\nc: *x\n",
+		"a: &x\n    - 1\nc: *x\n",
+		"- &x !t\n  b: 1\n- *x\n",
+	} {
+		var doc yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+		out, err := yaml.Marshal(&doc)
+		require.NoError(t, err)
+		require.Equal(t, data, string(out))
+	}
+}
+
+func TestNodeUnusedAnchors(t *testing.T) {
+	data := `
+base: &base {a: 1}
+extra: &extra [1, 2]
+name: &name web
+other: &base {b: 2}
+service:
+  <<: *base
+  name: *name
+  port: &port 80
+`
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(data), &doc)
+	require.NoError(t, err)
+	require.Equal(t, []string{"base", "extra", "port"}, doc.UnusedAnchors())
+
+	err = yaml.Unmarshal([]byte("a: &a 1\nb: *a\n"), &doc)
+	require.NoError(t, err)
+	require.Nil(t, doc.UnusedAnchors())
+
+	built := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "x", Anchor: "x"},
+		{Kind: yaml.ScalarNode, Value: "y", Anchor: "y"},
+		{Kind: yaml.AliasNode, Value: "x"},
+	}}
+	require.Equal(t, []string{"y"}, built.UnusedAnchors())
+}
+
+func TestNodeContentHash(t *testing.T) {
+	hash := func(data string) uint64 {
+		t.Helper()
+		var doc yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+		return doc.ContentHash()
+	}
+	base := hash("name: web\nport: 80\ntags: [a, b]\nlimits: {cpu: 1.5, ttl: 2001-12-14t21:59:43.10-05:00}\n")
+	for _, data := range []string{
+		"# service\ntags:\n  - 'a'\n  - \"b\"\nport: 0x50 # http\nlimits:\n  ttl: 2001-12-15T02:59:43.1Z\n  cpu: 1.50\nname: !!str web\n",
+		"{port: !!int 80, name: \"w\\x65b\", limits: {ttl: 2001-12-15 2:59:43.10, cpu: 15e-1}, tags: &t [a, b]}\n",
+		"name: &w web\nport: 80\ntags: [a, b]\nlimits: {cpu: 1.5, ttl: 2001-12-14t21:59:43.10-05:00}\n",
+	} {
+		require.Equal(t, base, hash(data), data)
+	}
+	for _, data := range []string{
+		"name: web\nport: '80'\ntags: [a, b]\nlimits: {cpu: 1.5, ttl: 2001-12-14t21:59:43.10-05:00}\n",
+		"name: web\nport: 80\ntags: [b, a]\nlimits: {cpu: 1.5, ttl: 2001-12-14t21:59:43.10-05:00}\n",
+		"name: web\nport: 80\ntags: [a, b]\nlimits: {cpu: 1.5}\n",
+		"name: port\nweb: 80\ntags: [a, b]\nlimits: {cpu: 1.5, ttl: 2001-12-14t21:59:43.10-05:00}\n",
+	} {
+		require.NotEqual(t, base, hash(data), data)
+	}
+
+	require.Equal(t, hash("a: &x 1\nb: *x\n"), hash("b: 1\na: 1\n"))
+	require.NotEqual(t, hash("[]"), hash("{}"))
+	require.NotEqual(t, hash("[a, b]"), hash("{a: b}"))
+	built := &yaml.Node{Kind: yaml.ScalarNode, Value: "80"}
+	require.Equal(t, hash("80"), built.ContentHash())
+}
+
+func TestNodeStructFieldRoundtrip(t *testing.T) {
+	type config struct {
+		Name  string
+		Meta  yaml.Node
+		Extra *yaml.Node `yaml:",omitempty"`
+		Unset *yaml.Node
+	}
+	data := "name: x\nmeta:\n    # head\n    a: 1 # line\n    b: [1, 2]\nextra:\n    c: d # extra line\nunset: null\n"
+	var v config
+	err := yaml.Unmarshal([]byte(data), &v)
+	require.NoError(t, err)
+	require.Equal(t, yaml.MappingNode, v.Meta.Kind)
+	require.Equal(t, "# head", v.Meta.Content[0].HeadComment)
+	require.NotNil(t, v.Extra)
+	require.Equal(t, "# extra line", v.Extra.Content[1].LineComment)
+	require.Nil(t, v.Unset)
+
+	out, err := yaml.Marshal(&v)
+	require.NoError(t, err)
+	require.Equal(t, data, string(out))
+
+	v.Extra = nil
+	out, err = yaml.Marshal(&v)
+	require.NoError(t, err)
+	require.Equal(t, "name: x\nmeta:\n    # head\n    a: 1 # line\n    b: [1, 2]\nunset: null\n", string(out))
+
+	// Null sets a *Node field to nil, as for any other pointer.
+	v.Unset = &yaml.Node{Kind: yaml.ScalarNode, Value: "x"}
+	require.NoError(t, yaml.Unmarshal([]byte("unset: ~\n"), &v))
+	require.Nil(t, v.Unset)
+}
+
+func TestMergeDocuments(t *testing.T) {
+	parse := func(data string) *yaml.Node {
+		var doc yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+		return &doc
+	}
+	base := parse(`# Service settings.
+name: web
+server:
+  host: localhost # bind address
+  port: 80 # http port
+  tls:
+    enabled: false
+tags: [a, b]
+`)
+	overlay := parse(`server:
+  port: 8080
+  tls:
+    enabled: true
+    cert: /etc/cert.pem
+tags: [c]
+debug: true
+`)
+	want := `# Service settings.
+name: web
+server:
+    host: localhost # bind address
+    port: 8080 # http port
+    tls:
+        enabled: true
+        cert: /etc/cert.pem
+tags: [c]
+debug: true
+`
+	merged, err := yaml.MergeDocuments(base, overlay)
+	require.NoError(t, err)
+	out, err := yaml.Marshal(merged)
+	require.NoError(t, err)
+	require.Equal(t, want, string(out))
+
+	// The arguments are left unchanged.
+	out, err = yaml.Marshal(base)
+	require.NoError(t, err)
+	require.Contains(t, string(out), "port: 80 # http port\n")
+
+	merged, err = yaml.MergeDocumentsWith(base, overlay, yaml.AppendSequences)
+	require.NoError(t, err)
+	out, err = yaml.Marshal(merged)
+	require.NoError(t, err)
+	require.Contains(t, string(out), "tags: [a, b, c]\n")
+
+	merged, err = yaml.MergeDocuments(parse("a: &x {b: 1}\nc: *x\n"), parse("a: {d: 2}\n"))
+	require.NoError(t, err)
+	out, err = yaml.Marshal(merged)
+	require.NoError(t, err)
+	require.Equal(t, "a: &x {b: 1, d: 2}\nc: *x\n", string(out))
+
+	_, err = yaml.MergeDocuments(parse("a: &x {b: 1}\nc: *x\n"), parse("a: 1\n"))
+	require.EqualError(t, err, "yaml: merged document has alias *x to a node replaced by the overlay")
+}
+
+func TestNodeDocumentFootComment(t *testing.T) {
+	data := "key: value\n\n# trailing\n"
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+	require.Equal(t, "# trailing", doc.FootComment)
+	require.Equal(t, "", doc.Content[0].FootComment)
+	out, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+	require.Equal(t, data, string(out))
+
+	// The comment is written before the document end marker.
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetExplicitDocumentEnd(true)
+	require.NoError(t, enc.Encode(&doc))
+	require.NoError(t, enc.Close())
+	require.Equal(t, "key: value\n\n# trailing\n...\n", buf.String())
+
+	doc = yaml.Node{}
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &doc))
+	require.Equal(t, "# trailing", doc.FootComment)
+}
+
+func TestNodeDecodeSubtree(t *testing.T) {
+	data := `
+defaults: &defaults
+  port: 80
+  tags: &tags [a, b]
+services:
+  web:
+    <<: *defaults
+    name: web
+    labels: *tags
+`
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(data), &doc))
+	services := doc.Content[0].Content[3]
+	require.Equal(t, "web", services.Content[0].Value)
+	web := services.Content[1]
+
+	// The aliases refer to anchors outside of the decoded node.
+	var v struct {
+		Name   string
+		Port   int
+		Tags   []string
+		Labels []string
+	}
+	require.NoError(t, web.Decode(&v))
+	require.Equal(t, "web", v.Name)
+	require.Equal(t, 80, v.Port)
+	require.Equal(t, []string{"a", "b"}, v.Tags)
+	require.Equal(t, []string{"a", "b"}, v.Labels)
+}
@@ -0,0 +1,248 @@
+package yaml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reindent changes the indentation of the block collections in the YAML
+// documents in src from steps of from spaces to steps of to spaces, leaving
+// the rest of the text, such as comments, blank lines, quoting and flow
+// collections, as it is. The content of literal and folded scalars follows
+// its parent, and is reindented along with it unless it has an explicit
+// indentation indicator. Steps that are not a multiple of from, such as the
+// two spaces of "- " before the keys of a mapping in a sequence, are kept.
+//
+// Unlike decoding and encoding the documents, which formats them anew,
+// Reindent only changes the leading spaces of lines. An error is returned if
+// src cannot be parsed or if the result would not hold the same content.
+func Reindent(src []byte, from, to int) ([]byte, error) {
+	if from <= 0 || to <= 0 {
+		return nil, errors.New("yaml: indentation steps must be positive")
+	}
+	lines := bytes.Split(src, []byte("\n"))
+	r := reindenter{
+		from:   from,
+		to:     to,
+		lines:  lines,
+		shifts: make(map[int]int),
+		blocks: make(map[int]blockShift),
+	}
+	var docs []*Node
+	p := newParser(bytes.NewReader(src))
+	for {
+		doc, err := p.Parse()
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			break
+		}
+		docs = append(docs, doc)
+		for _, n := range doc.Content {
+			r.place(n, n.Column-1, -1, -1)
+		}
+	}
+
+	out := r.apply()
+	p = newParser(bytes.NewReader(out))
+	for _, doc := range docs {
+		got, err := p.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("yaml: cannot reindent from %d to %d spaces: %v", from, to, err)
+		}
+		if got == nil || got.ContentHash() != doc.ContentHash() {
+			return nil, fmt.Errorf("yaml: cannot reindent from %d to %d spaces without changing the content", from, to)
+		}
+	}
+	if extra, err := p.Parse(); err != nil || extra != nil {
+		return nil, fmt.Errorf("yaml: cannot reindent from %d to %d spaces without changing the content", from, to)
+	}
+	return out, nil
+}
+
+// blockShift describes the content of a literal or folded scalar, whose
+// lines follow the line holding its indicator.
+type blockShift struct {
+	parent int // The column of the enclosing collection.
+	shift  int // The change of indentation of the content.
+}
+
+type reindenter struct {
+	from, to int
+	lines    [][]byte
+	shifts   map[int]int        // The change of indentation of lines starting with a node, by line index.
+	blocks   map[int]blockShift // The block scalars, by the line index of their indicator.
+}
+
+// indent returns the number of leading spaces of the line at index i.
+func (r *reindenter) indent(i int) int {
+	if i < 0 || i >= len(r.lines) {
+		return -1
+	}
+	line := r.lines[i]
+	return len(line) - len(bytes.TrimLeft(line, " "))
+}
+
+// step returns the new size of an indentation step of n spaces.
+func (r *reindenter) step(n int) int {
+	if n%r.from != 0 {
+		return n
+	}
+	return n / r.from * r.to
+}
+
+// start returns the line index and column where the content of node n
+// starts. They differ from the position of n for a block collection whose
+// anchor or tag is alone on a previous line: the content of a mapping then
+// starts with its first key, and the one of a sequence with the "-" that
+// starts the line of its first item.
+func (r *reindenter) start(n *Node) (line, col int) {
+	line, col = n.Line-1, n.Column-1
+	if n.Style&FlowStyle != 0 || len(n.Content) == 0 || n.Content[0].Line-1 == line {
+		return line, col
+	}
+	switch n.Kind {
+	case MappingNode:
+		return n.Content[0].Line - 1, n.Content[0].Column - 1
+	case SequenceNode:
+		return n.Content[0].Line - 1, r.indent(n.Content[0].Line - 1)
+	}
+	return line, col
+}
+
+// place records the change of indentation of node n, whose content moves
+// to column col, and of the nodes within it. parent and newParent are the
+// old and new columns of the enclosing block collection, or -1 at the top
+// level.
+func (r *reindenter) place(n *Node, col, parent, newParent int) {
+	line, old := r.start(n)
+	if _, ok := r.shifts[line]; !ok && r.indent(line) == old {
+		r.shifts[line] = col - old
+	}
+	if props := n.Line - 1; props != line {
+		// The anchor or tag alone on its line moves with the content.
+		if _, ok := r.shifts[props]; !ok && r.indent(props) == n.Column-1 {
+			r.shifts[props] = col - old
+		}
+	}
+	if n.Style&FlowStyle != 0 {
+		return
+	}
+	switch n.Kind {
+	case MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			r.place(key, col+key.Column-1-old, old, col)
+			if vline, vcol := r.start(value); vline > key.Line-1 {
+				r.place(value, col+r.step(vcol-old), old, col)
+			} else {
+				r.place(value, col+vcol-old, old, col)
+			}
+		}
+	case SequenceNode:
+		for _, item := range n.Content {
+			itemLine, itemCol := r.start(item)
+			sameLine := r.indent(item.Line-1) == old
+			if sameLine {
+				// The item, or its anchor or tag, follows the "-"
+				// indicator on the same line.
+				if _, ok := r.shifts[item.Line-1]; !ok {
+					r.shifts[item.Line-1] = col - old
+				}
+			}
+			if sameLine && itemLine == item.Line-1 {
+				r.place(item, col+itemCol-old, old, col)
+			} else {
+				r.place(item, col+r.step(itemCol-old), old, col)
+			}
+		}
+	case ScalarNode:
+		if n.Style&(LiteralStyle|FoldedStyle) == 0 || parent < 0 {
+			return
+		}
+		header := r.lines[line][old:]
+		if i := bytes.IndexAny(header, "|>"); i >= 0 {
+			header = header[i:]
+		}
+		if end := bytes.IndexAny(header, " \t#\r"); end >= 0 {
+			header = header[:end]
+		}
+		shift := newParent - parent
+		if !bytes.ContainsAny(header, "123456789") {
+			for i := line + 1; i < len(r.lines); i++ {
+				if len(bytes.TrimSpace(r.lines[i])) == 0 {
+					continue
+				}
+				if step := r.indent(i) - parent; r.indent(i) > parent {
+					shift += r.step(step) - step
+				}
+				break
+			}
+		}
+		r.blocks[line] = blockShift{parent: parent, shift: shift}
+	}
+}
+
+// apply returns the lines with their indentation changed. Lines that do not
+// start with a node, such as comments and the continuation lines of scalars
+// and flow collections, move along with the closest line above them that
+// is indented less or as much.
+func (r *reindenter) apply() []byte {
+	type level struct{ indent, shift int }
+	var stack []level
+	var block *blockShift
+	var buf bytes.Buffer
+	for i, line := range r.lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		blank := len(bytes.TrimSpace(line)) == 0
+		indent := r.indent(i)
+		if block != nil && (blank || indent > block.parent) {
+			if !blank {
+				writeShifted(&buf, line, indent, block.shift)
+			} else {
+				buf.Write(line)
+			}
+			continue
+		}
+		block = nil
+		shift, ok := r.shifts[i]
+		if ok {
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+			stack = append(stack, level{indent, shift})
+		} else {
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j].indent <= indent {
+					shift = stack[j].shift
+					break
+				}
+			}
+		}
+		if blank {
+			buf.Write(line)
+		} else {
+			writeShifted(&buf, line, indent, shift)
+		}
+		if b, ok := r.blocks[i]; ok {
+			block = &b
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeShifted writes line, which has indent leading spaces, with shift
+// spaces added to them or removed from them.
+func writeShifted(w io.Writer, line []byte, indent, shift int) {
+	n := indent + shift
+	if n < 0 {
+		n = 0
+	}
+	w.Write(bytes.Repeat([]byte(" "), n))
+	w.Write(line[indent:])
+}
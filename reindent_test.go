@@ -0,0 +1,99 @@
+package yaml_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/yaml"
+)
+
+func TestReindent(t *testing.T) {
+	src := `# Service settings.
+name: web   # aligned comment
+server:
+    host: localhost
+
+    # The port to listen on.
+    port: 80
+    tls:
+        enabled: true
+items:
+    - name: a
+      value: b
+    - - x
+      - y
+script: |
+    echo one
+      indented
+    echo two
+fixed: |4
+        kept as is
+flow: {a: 1,
+    b: 2}
+list:
+- a
+- b:
+      c: 1
+---
+other:
+    x: 1
+`
+	want := `# Service settings.
+name: web   # aligned comment
+server:
+  host: localhost
+
+  # The port to listen on.
+  port: 80
+  tls:
+    enabled: true
+items:
+  - name: a
+    value: b
+  - - x
+    - y
+script: |
+  echo one
+    indented
+  echo two
+fixed: |4
+        kept as is
+flow: {a: 1,
+    b: 2}
+list:
+- a
+- b:
+    c: 1
+---
+other:
+  x: 1
+`
+	out, err := yaml.Reindent([]byte(src), 4, 2)
+	require.NoError(t, err)
+	require.Equal(t, want, string(out))
+
+	out, err = yaml.Reindent(out, 2, 4)
+	require.NoError(t, err)
+	require.Equal(t, src, string(out))
+
+	// Anchors and tags alone on their line don't count as the content.
+	for _, tt := range []struct{ src, want string }{
+		{"a: &x\n    b: 1\nc:\n    d: 1\n", "a: &x\n  b: 1\nc:\n  d: 1\n"},
+		{"a: !t\n    - 1\n    - &y\n        e: 2\n", "a: !t\n  - 1\n  - &y\n    e: 2\n"},
+		{"a: &x !t\n    b:\n        - 1\nc: *x\n", "a: &x !t\n  b:\n    - 1\nc: *x\n"},
+		{"a:\n    &x\n    b: 1\n", "a:\n  &x\n  b: 1\n"},
+	} {
+		out, err = yaml.Reindent([]byte(tt.src), 4, 2)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, string(out))
+		out, err = yaml.Reindent(out, 2, 4)
+		require.NoError(t, err)
+		require.Equal(t, tt.src, string(out))
+	}
+
+	_, err = yaml.Reindent([]byte("a: [1\n"), 4, 2)
+	require.Error(t, err)
+
+	_, err = yaml.Reindent([]byte("a: 1\n"), 0, 2)
+	require.EqualError(t, err, "yaml: indentation steps must be positive")
+}
@@ -22,15 +22,23 @@ package yaml
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 
+	"github.com/willabides/yaml/internal/parserc"
 	"github.com/willabides/yaml/internal/resolve"
+	"github.com/willabides/yaml/internal/yamlh"
 )
 
 // The Unmarshaler interface may be implemented by types to customize their
@@ -75,6 +83,15 @@ type Marshaler interface {
 // used to tweak the marshalling process (see Marshal).
 // Conflicting names result in a runtime error.
 //
+// Null unmarshals into a slice, map, pointer or interface as nil, and an
+// empty sequence or mapping, such as [] or {}, as an empty, non-nil slice or
+// map, so the two can be told apart (see Decoder.SetNullMode). A mapping
+// unmarshalled into a non-nil map adds its entries to the existing ones.
+//
+// A mapping may also be unmarshalled into a slice of structs made of two
+// fields with the keys "key" and "value", such as
+// []struct{ Key string; Value int }, which keeps the order of the document.
+//
 // For example:
 //
 //	type T struct {
@@ -90,10 +107,68 @@ func Unmarshal(in []byte, out interface{}) (err error) {
 	return unmarshal(in, out, false)
 }
 
+// UnmarshalAll decodes every document found within the in byte slice,
+// appending each one as a new element of the slice pointed to by out. A
+// stream such as "a\n---\nb" unmarshalled into a *[]string results in
+// []string{"a", "b"}.
+//
+// Documents that cannot be fully decoded are still appended, and a
+// *yaml.TypeError is returned with details for all missed values once the
+// whole stream has been read. See Unmarshal for details about the
+// conversion of each document.
+func UnmarshalAll(in []byte, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("yaml: UnmarshalAll needs a non-nil pointer to a slice, got %T", out)
+	}
+	slice := v.Elem()
+	dec := NewDecoder(bytes.NewReader(in))
+	var typeErrors []string
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		err := dec.Decode(elem.Interface())
+		if err == io.EOF {
+			break
+		}
+		if e, ok := err.(*TypeError); ok {
+			typeErrors = append(typeErrors, e.Errors...)
+		} else if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	if len(typeErrors) > 0 {
+		return &TypeError{typeErrors}
+	}
+	return nil
+}
+
 // A Decoder reads and decodes YAML values from an input stream.
 type Decoder struct {
-	parser      Parser
+	parser      *parser
 	knownFields bool
+	octalMode   OctalMode
+
+	keepTaggedAsNode   bool
+	precisionLossError bool
+	stringKeys         bool
+	stringInterning    bool
+	complexKeyMode     ComplexKeyMode
+	exactFloatToInt    bool
+	nullMode           NullMode
+	timestampType      reflect.Type
+	timestampField     int
+
+	factories  map[reflect.Type]func(name string) (interface{}, error)
+	typeHints  map[string]reflect.Type
+	validators map[string]func(reflect.Value) error
+
+	useSQLScanner            bool
+	leadingZeroAsString      bool
+	caseInsensitiveFields    bool
+	requireExplicitAmbiguous bool
+	promoteEmbedded          bool
+	stringsAsRunes           bool
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -102,7 +177,7 @@ type Decoder struct {
 // data from r beyond the YAML values requested.
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
-		parser: NewParserFromReader(r),
+		parser: newParser(r),
 	}
 }
 
@@ -112,14 +187,590 @@ func (dec *Decoder) KnownFields(enable bool) {
 	dec.knownFields = enable
 }
 
+// SetCaseInsensitiveFields makes the decoder match mapping keys to struct
+// fields regardless of case when there is no field with the exact key, as
+// encoding/json does, so MaxRetries, maxretries and MAXRETRIES all set a
+// field with the key maxretries. When several fields match, the first one
+// in the struct wins. Keys that still match no field are reported as usual
+// when KnownFields is enabled.
+func (dec *Decoder) SetCaseInsensitiveFields(enable bool) {
+	dec.caseInsensitiveFields = enable
+}
+
+// SetPromoteEmbeddedPointers makes the decoder set the fields of untagged
+// embedded pointers to structs from the keys of the outer mapping, as
+// encoding/json does. The pointer is left nil unless one of its fields is
+// present. Fields of the outer struct take priority, and keys matching
+// fields of several embedded pointers are ignored. The embedded field can
+// still be set from its own key, and encoding is not affected.
+func (dec *Decoder) SetPromoteEmbeddedPointers(enable bool) {
+	dec.promoteEmbedded = enable
+}
+
+// OctalMode selects how the decoder interprets integers written with a
+// leading zero.
+type OctalMode int
+
+const (
+	// Legacy11 decodes both 0o17 (YAML 1.2) and 017 (YAML 1.1) as octal.
+	// This is the default.
+	Legacy11 OctalMode = iota
+
+	// Strict12 only decodes 0o17 as octal. Integers with leading zeros
+	// such as 017 are decoded as decimal, so zero-padded IDs keep their
+	// value.
+	Strict12
+)
+
+// SetOctalMode sets how integers with a leading zero are decoded.
+func (dec *Decoder) SetOctalMode(mode OctalMode) {
+	dec.octalMode = mode
+}
+
+// NonSpecificTagMode selects how the decoder resolves plain scalars with the
+// non-specific tag "!", such as "! 123".
+//
+// The YAML specification resolves nodes with the "!" tag according to their
+// kind alone, so scalars are strings, and only untagged plain scalars are
+// resolved from their value, as integers, booleans and so on. Many YAML
+// implementations ignore the "!" tag instead.
+type NonSpecificTagMode int
+
+const (
+	// NonSpecificResolve ignores the "!" tag, resolving the value as if it
+	// was untagged, so "! 123" is an integer. This is the default.
+	NonSpecificResolve NonSpecificTagMode = iota
+
+	// NonSpecificAsString resolves scalars with the "!" tag as strings, as
+	// the specification requires, so "! 123" is the string "123".
+	NonSpecificAsString
+)
+
+// SetNonSpecificTagMode sets how plain scalars with the "!" tag are decoded.
+// Sequences and mappings with the "!" tag are unaffected.
+func (dec *Decoder) SetNonSpecificTagMode(mode NonSpecificTagMode) {
+	dec.parser.nonSpecificAsString = mode == NonSpecificAsString
+}
+
+// SetLeadingZeroAsString makes untagged integers written with a leading
+// zero, such as the zero-padded 007 or the zip code 08540, decode as strings
+// that keep the padding, rather than as octal or decimal integers. They can
+// then only be decoded into strings and interfaces. 0 itself, and numbers
+// such as 0.5 or 0x1f, are not affected. It takes precedence over
+// SetOctalMode.
+func (dec *Decoder) SetLeadingZeroAsString(enable bool) {
+	dec.leadingZeroAsString = enable
+}
+
+// SetRequireExplicitAmbiguous makes decoding a plain scalar that is
+// ambiguous between two types into an interface{} fail with a *TypeError
+// asking for an explicit tag or quotes, for ingestion that must not guess
+// the type of a value. A plain scalar is one without a tag, quotes or a
+// literal or folded style, and it is ambiguous when it is either:
+//
+//   - a timestamp, such as 2015-01-01, which is decoded as a time.Time but
+//     may be meant as a string, or
+//   - a YAML 1.1 boolean that YAML 1.2 reads as a string, that is y, yes, on,
+//     n, no or off in lower, title or upper case, which is decoded as a
+//     string but may be meant as a bool.
+//
+// Such scalars are still decoded as usual into typed values, such as a
+// string, a time.Time or a bool, where the type settles the question.
+func (dec *Decoder) SetRequireExplicitAmbiguous(enable bool) {
+	dec.requireExplicitAmbiguous = enable
+}
+
+// SetStringsAsRunes makes strings decode into a []rune as their characters,
+// and a string made of a single character into a rune as that character.
+// As rune is an alias for int32, this applies to all int32 values, so it is
+// off by default.
+func (dec *Decoder) SetStringsAsRunes(enable bool) {
+	dec.stringsAsRunes = enable
+}
+
+// SetKeepTaggedAsNode makes values explicitly tagged with a tag outside of
+// the "!!" namespace, such as !custom, decode as a *Node when the target is
+// an empty interface, so the tag is not lost. Values with standard tags are
+// decoded as usual.
+func (dec *Decoder) SetKeepTaggedAsNode(enable bool) {
+	dec.keepTaggedAsNode = enable
+}
+
+// SetPrecisionLossError makes decoding a number into a float field that
+// cannot hold it exactly a type error, such as 16777217 or 0.1 into a
+// float32, or 2^53+1 into a float64. By default the nearest float is used.
+func (dec *Decoder) SetPrecisionLossError(enable bool) {
+	dec.precisionLossError = enable
+}
+
+// SetExactFloatToInt makes decoding a float, such as 1e3 or 1000.0, into an
+// integer field only succeed when the float is an integer in the range of
+// the field. Other floats, such as 1.5 or -1 into an unsigned field, are a
+// type error. By default floats are truncated towards zero.
+func (dec *Decoder) SetExactFloatToInt(enable bool) {
+	dec.exactFloatToInt = enable
+}
+
+// NullMode selects what decoding null into a slice or a map does. An
+// explicit empty sequence or mapping, such as [] or {}, always decodes as an
+// empty, non-nil value.
+type NullMode int
+
+const (
+	// NullMakesNil sets the slice or map to nil. This is the default.
+	NullMakesNil NullMode = iota
+
+	// NullMakesEmpty sets the slice or map to an empty, non-nil value, so
+	// that only a missing key leaves a slice or map field nil.
+	NullMakesEmpty
+
+	// NullKeepsValue leaves the slice or map untouched, as a missing key
+	// does.
+	NullKeepsValue
+)
+
+// SetNullMode sets what decoding null into a slice or a map does.
+func (dec *Decoder) SetNullMode(mode NullMode) {
+	dec.nullMode = mode
+}
+
+// SetTimestampType sets the type timestamps are decoded as when the target
+// is an interface, in place of time.Time. typ must be a type time.Time
+// converts to, such as a type defined as time.Time, or a struct embedding
+// time.Time, which is set to the timestamp. A nil typ restores the default.
+// SetTimestampType panics when typ is neither.
+func (dec *Decoder) SetTimestampType(typ reflect.Type) {
+	field := -1
+	if typ != nil && !timeType.ConvertibleTo(typ) {
+		if typ.Kind() == reflect.Struct {
+			for i := 0; i < typ.NumField(); i++ {
+				if f := typ.Field(i); f.Anonymous && f.Type == timeType {
+					field = i
+					break
+				}
+			}
+		}
+		if field == -1 {
+			panic("yaml: cannot decode timestamps as " + typ.String())
+		}
+	}
+	dec.timestampType = typ
+	dec.timestampField = field
+}
+
+// SetStringKeys makes untagged scalar mapping keys decode as strings, so
+// keys such as on, 123 or null are decoded as "on", "123" and "null" rather
+// than resolved to a bool, an int or nil. Explicitly tagged keys are decoded
+// as usual.
+func (dec *Decoder) SetStringKeys(enable bool) {
+	dec.stringKeys = enable
+}
+
+// ComplexKeyMode selects how the decoder handles mapping keys that are
+// sequences or mappings, which cannot be keys of Go maps.
+type ComplexKeyMode int
+
+const (
+	// ComplexKeyError makes decoding a sequence or mapping key into a map
+	// fail. This is the default.
+	ComplexKeyError ComplexKeyMode = iota
+
+	// ComplexKeyStringify decodes sequence and mapping keys as a string
+	// holding their flow style YAML, such as "[a, b]" or "{a: 1}", so they
+	// can be decoded into maps with string or interface keys.
+	ComplexKeyStringify
+)
+
+// SetComplexKeyMode sets how sequence and mapping keys are decoded.
+func (dec *Decoder) SetComplexKeyMode(mode ComplexKeyMode) {
+	dec.complexKeyMode = mode
+}
+
+// SetStringInterning makes equal strings decoded from a document share the
+// same memory, which reduces the memory used by documents that repeat the
+// same values many times. It costs a map lookup for every decoded string.
+func (dec *Decoder) SetStringInterning(enable bool) {
+	dec.stringInterning = enable
+}
+
+// SetFactory registers factory to build the values of type fieldType, which
+// is usually an interface type for pluggable components. Scalars decoded
+// into a fieldType are passed to factory, and the value it returns, which
+// must be assignable to fieldType, is stored in place of decoding the
+// scalar. An error returned by factory stops decoding, and is returned
+// wrapped with the line of the scalar. Null values are decoded as usual. A
+// nil factory removes the one registered for fieldType.
+func (dec *Decoder) SetFactory(fieldType reflect.Type, factory func(name string) (interface{}, error)) {
+	if factory == nil {
+		delete(dec.factories, fieldType)
+		return
+	}
+	if dec.factories == nil {
+		dec.factories = make(map[reflect.Type]func(name string) (interface{}, error))
+	}
+	dec.factories[fieldType] = factory
+}
+
+// SetTypeHints sets the concrete types that nodes explicitly tagged with the
+// tags in hints, such as "!user", are decoded as when the target is an
+// interface, such as a field of type interface{}, which would otherwise hold
+// a generic map or slice. The hinted type is used when it is assignable to
+// the interface, and hinted values are stored in it directly, not as
+// pointers. Tags may be given in their short or long form. Targets of
+// concrete types are decoded as usual.
+func (dec *Decoder) SetTypeHints(hints map[string]reflect.Type) {
+	dec.typeHints = make(map[string]reflect.Type, len(hints))
+	for tag, typ := range hints {
+		dec.typeHints[resolve.ShortTag(tag)] = typ
+	}
+}
+
+// RegisterValidator registers fn as the validator named name, which struct
+// fields refer to with the validate option, as in `yaml:"port,validate=port"`.
+// fn is called with the field once it has been decoded, or, for a field with
+// the repeated option, with each element as it is decoded from one of the
+// occurrences of the key. An error it returns is reported, with the line of
+// the value, as part of the *TypeError returned by Decode. Decoding a field
+// that refers to a validator not registered with the decoder is also a type
+// error.
+func (dec *Decoder) RegisterValidator(name string, fn func(reflect.Value) error) {
+	if dec.validators == nil {
+		dec.validators = make(map[string]func(reflect.Value) error)
+	}
+	dec.validators[name] = fn
+}
+
+// SetUseSQLScanner makes scalars decode into types implementing
+// database/sql.Scanner, such as sql.NullInt64, by passing their resolved
+// value to Scan, so database types can be reused in configuration. Scan
+// receives an int64, or a uint64 for larger integers, a float64, bool,
+// string, time.Time or, for !!binary values, a []byte, and takes precedence
+// over encoding.TextUnmarshaler. An error it returns stops decoding. Null
+// values leave the target set to its zero value as usual.
+func (dec *Decoder) SetUseSQLScanner(enable bool) {
+	dec.useSQLScanner = enable
+}
+
+// SetMaxMapEntries limits the number of entries in any single mapping.
+// Decoding fails with an error once a mapping has more than n entries. A
+// value of 0 or less, the default, means no limit.
+func (dec *Decoder) SetMaxMapEntries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	dec.parser.maxMapEntries = n
+}
+
+// SetMaxDocumentMapEntries limits the total number of mapping entries in a
+// document, across all of its mappings. Decoding fails with an error once a
+// document has more than n entries. A value of 0 or less, the default, means
+// no limit.
+func (dec *Decoder) SetMaxDocumentMapEntries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	dec.parser.maxDocMapEntries = n
+}
+
+// SetMaxInputBytes limits the number of bytes the decoder consumes from its
+// reader. Once more than n bytes have been consumed, decoding fails with an
+// error. A value of 0 or less, the default, means no limit.
+//
+// The limit covers the whole stream, not each document. As the decoder reads
+// ahead of the document being decoded, the error may be reported before
+// reaching the document that crosses the limit.
+func (dec *Decoder) SetMaxInputBytes(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	dec.parser.parser.Max_input_bytes = n
+}
+
+// SetReadTimeout makes decoding fail with an error when a read from the
+// underlying reader produces no data within d, so a reader that stalls, as
+// with a client sending a document slowly on purpose, cannot block the
+// decoder forever. Reads run on a separate goroutine, so any reader can be
+// used, but a read that timed out keeps running until the reader returns;
+// closing the reader, when possible, releases it. A value of 0 or less, the
+// default, means no timeout.
+func (dec *Decoder) SetReadTimeout(d time.Duration) {
+	r := dec.parser.parser.Reader
+	if tr, ok := r.(*timeoutReader); ok {
+		if tr.result != nil || len(tr.rest) > 0 || tr.err != nil {
+			// A read is pending or buffered: keep the same reader.
+			tr.timeout = d
+			return
+		}
+		r = tr.r
+	}
+	if d > 0 {
+		r = &timeoutReader{r: r, timeout: d}
+	}
+	dec.parser.parser.Reader = r
+}
+
+// timeoutReader reads from r on a separate goroutine and gives up waiting
+// for a read after timeout. The data of a read that completes after giving
+// up is returned by the next calls to Read.
+type timeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	buf     []byte
+	result  chan timeoutReadResult // The pending read, if any.
+	rest    []byte                 // Data read and not yet returned.
+	err     error                  // Error to return once rest is drained.
+}
+
+type timeoutReadResult struct {
+	n   int
+	err error
+}
+
+func (t *timeoutReader) Read(p []byte) (int, error) {
+	if len(t.rest) == 0 && t.err == nil {
+		if t.result == nil {
+			if cap(t.buf) < len(p) {
+				t.buf = make([]byte, len(p))
+			}
+			buf := t.buf[:len(p)]
+			result := make(chan timeoutReadResult, 1)
+			go func() {
+				n, err := t.r.Read(buf)
+				result <- timeoutReadResult{n, err}
+			}()
+			t.result = result
+		}
+		var timeout <-chan time.Time
+		if t.timeout > 0 {
+			timer := time.NewTimer(t.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case res := <-t.result:
+			t.result = nil
+			t.rest = t.buf[:res.n]
+			t.err = res.err
+		case <-timeout:
+			return 0, fmt.Errorf("read timed out after %v", t.timeout)
+		}
+	}
+	n := copy(p, t.rest)
+	t.rest = t.rest[n:]
+	if len(t.rest) > 0 {
+		return n, nil
+	}
+	err := t.err
+	t.err = nil
+	return n, err
+}
+
+// SetMaxAnchorNameLen limits the length of the names of anchors and
+// aliases, so a document cannot waste memory with huge names. Decoding
+// fails with an error at the first longer name. A value of 0 restores the
+// default limit of 1024 characters, and a negative value removes the limit,
+// as in yaml.v3.
+func (dec *Decoder) SetMaxAnchorNameLen(n int) {
+	if n < 0 {
+		n = -1
+	}
+	dec.parser.parser.Max_anchor_len = n
+}
+
+// SetAcceptedVersions sets the versions, given as {major, minor}, that a
+// %YAML directive may declare. A document declaring any other version fails
+// to decode with an error naming that version. Documents without a %YAML
+// directive are not affected. By default, and when called with no versions,
+// only 1.1 is accepted, and other versions fail with the "found incompatible
+// YAML document" error of yaml.v3.
+func (dec *Decoder) SetAcceptedVersions(versions ...[2]int) {
+	dec.parser.parser.Accepted_versions = append([][2]int(nil), versions...)
+}
+
+// SetLenientDirectives makes a document with duplicate %YAML or %TAG
+// directives for the same handle decode using the last of them, rather than
+// failing, as some generators write such documents. It is disabled by
+// default.
+func (dec *Decoder) SetLenientDirectives(enable bool) {
+	dec.parser.parser.Lenient_directives = enable
+}
+
+// SetMaxLines limits the number of lines the decoder reads. Decoding fails
+// with an error once the input has content beyond line n, so a line break
+// ending line n is accepted. As with SetMaxInputBytes, the limit covers the
+// whole stream. A value of 0 or less, the default, means no limit.
+func (dec *Decoder) SetMaxLines(n int) {
+	if n < 0 {
+		n = 0
+	}
+	dec.parser.parser.Max_lines = n
+}
+
+// SetTrimTrailingSpace makes the decoder remove trailing Unicode white space
+// from plain scalars, such as no-break spaces (U+00A0) or ideographic spaces
+// (U+3000), before resolving them. Trailing spaces and tabs are already
+// removed from plain scalars, including from every line of multi-line ones,
+// as YAML requires. Quoted and block scalars are left untouched.
+func (dec *Decoder) SetTrimTrailingSpace(enable bool) {
+	dec.parser.trimTrailingSpace = enable
+}
+
+// SetRejectTabs makes decoding fail on any tab character in the input, with
+// an error giving its position, including where YAML allows tabs, such as
+// inside flow collections, quoted scalars and comments.
+func (dec *Decoder) SetRejectTabs(enable bool) {
+	dec.parser.parser.Reject_tabs = enable
+}
+
+// SetErrorRecovery makes the decoder recover from a missing ":" after a
+// mapping key, such as "port 80" on its own line within a block mapping,
+// rather than failing. The line holding the key is skipped, a warning is
+// recorded in Warnings and decoding continues with the next line.
+//
+// Only that error is recovered from, and only when the key is not the first
+// key of its mapping, which would not be recognized as a mapping otherwise.
+// It is not recovered from within flow collections, nor for keys longer than
+// 1024 characters. All other errors still fail decoding.
+func (dec *Decoder) SetErrorRecovery(enable bool) {
+	dec.parser.parser.Error_recovery = enable
+}
+
+// Warnings returns the errors recovered from since the decoder was created,
+// when enabled with SetErrorRecovery, such as
+// "line 3: could not find expected ':'". The line was skipped for each of
+// them.
+func (dec *Decoder) Warnings() []string {
+	var warnings []string
+	for _, w := range dec.parser.parser.Warnings {
+		warnings = append(warnings, fmt.Sprintf("line %d: %s", w.Line, w.Problem))
+	}
+	return warnings
+}
+
+// SetReadBufferSize sets the number of bytes the decoder asks its reader
+// for at a time. Larger sizes reduce the number of reads when decoding
+// large documents. Sizes smaller than the default of 512 bytes are raised
+// to it.
+func (dec *Decoder) SetReadBufferSize(n int) {
+	dec.parser.parser.SetReadBufferSize(n)
+}
+
 // Decode reads the next YAML-encoded value from its input
 // and stores it in the value pointed to by v.
 //
 // See the documentation for Unmarshal for details about the
 // conversion of YAML into a Go value.
 func (dec *Decoder) Decode(v interface{}) (errOut error) {
+	return dec.decode(v, nil)
+}
+
+// DecodeSequence reads the next YAML document, whose root must be a
+// sequence, and calls fn with each item of the sequence as soon as it has
+// been parsed. Items are not kept once fn returns, so the memory used does
+// not grow with the length of the sequence, apart from anchored nodes kept
+// for later aliases. Decoding stops with the error returned by fn, if any.
+// After such an error, or when the root is not a sequence, the rest of the
+// document is skipped so that the next call reads the next document.
+//
+// DecodeSequence returns io.EOF when there are no more documents.
+func (dec *Decoder) DecodeSequence(fn func(item *Node) error) error {
+	return dec.parser.sequenceItems(fn)
+}
+
+// DecodeMapping reads the next YAML document, whose root must be a
+// mapping, and calls fn with the key and value of each entry as soon as it
+// has been parsed. Entries are not kept once fn returns, so the memory used
+// does not grow with the size of the mapping, apart from anchored nodes kept
+// for later aliases. Keys must be scalars, and merge keys are passed to fn
+// like any other. Unlike Decode, DecodeMapping does not detect keys that are
+// defined more than once, which would take keeping all of them, so fn is
+// called for each occurrence and must detect them if needed. Decoding stops
+// with the error returned by fn, if any. After such an error, or when the
+// root is not a mapping or a key is not a scalar, the rest of the document
+// is skipped so that the next call reads the next document.
+//
+// DecodeMapping returns io.EOF when there are no more documents.
+func (dec *Decoder) DecodeMapping(fn func(key string, value *Node) error) error {
+	return dec.parser.mappingEntries(fn)
+}
+
+// DecodeWithPresence works like Decode, and additionally records in present
+// the dotted path of every mapping key found in the document, such as
+// "server.port" or "servers.0.port" for keys inside sequence items. This
+// allows telling a field explicitly set to its zero value apart from one that
+// was absent from the document.
+func (dec *Decoder) DecodeWithPresence(v interface{}, present *FieldSet) error {
+	return dec.decode(v, present)
+}
+
+// newDecoder returns a decoder set up with the options of dec.
+func (dec *Decoder) newDecoder() *decoder {
 	d := newDecoder()
 	d.knownFields = dec.knownFields
+	d.octalMode = dec.octalMode
+	d.keepTaggedAsNode = dec.keepTaggedAsNode
+	d.precisionLossError = dec.precisionLossError
+	d.stringKeys = dec.stringKeys
+	d.complexKeyMode = dec.complexKeyMode
+	d.exactFloatToInt = dec.exactFloatToInt
+	d.nullMode = dec.nullMode
+	d.timestampType = dec.timestampType
+	d.timestampField = dec.timestampField
+	d.factories = dec.factories
+	d.typeHints = dec.typeHints
+	d.validators = dec.validators
+	d.useSQLScanner = dec.useSQLScanner
+	d.leadingZeroAsString = dec.leadingZeroAsString
+	d.caseInsensitiveFields = dec.caseInsensitiveFields
+	d.requireExplicitAmbiguous = dec.requireExplicitAmbiguous
+	d.promoteEmbedded = dec.promoteEmbedded
+	d.stringsAsRunes = dec.stringsAsRunes
+	if dec.stringInterning {
+		d.interned = make(map[string]string)
+	}
+	return d
+}
+
+// DecodeTypedMap decodes node, a mapping or a document holding one, into
+// out with the value of each key decoded into a new value of the type
+// returned by typeForKey for that key, such as a distinct struct type for
+// each entry of a plugin registry. When typeForKey returns nil the value is
+// decoded as for an interface{}. Keys must be strings, and merge keys
+// ("<<") are applied as when decoding a map. The options of dec apply, but
+// nothing is read from its input.
+func (dec *Decoder) DecodeTypedMap(node *Node, typeForKey func(key string) reflect.Type, out map[string]interface{}) error {
+	if out == nil {
+		return errors.New("yaml: DecodeTypedMap needs a non-nil map")
+	}
+	if node == nil {
+		return errors.New("yaml: DecodeTypedMap needs a non-nil node")
+	}
+	d := dec.newDecoder()
+	if node.Kind == DocumentNode && len(node.Content) == 1 {
+		node = node.Content[0]
+	}
+	if node.Kind == AliasNode {
+		if node.Alias == nil {
+			return fmt.Errorf("yaml: unknown anchor '%s' referenced", node.Value)
+		}
+		node = node.Alias
+	}
+	if node.Kind != MappingNode {
+		d.terror(node, resolve.MapTag, reflect.ValueOf(out))
+		return &TypeError{d.typeErrors}
+	}
+	if err := d.typedMap(node, typeForKey, out, make(map[string]bool)); err != nil {
+		return err
+	}
+	if len(d.typeErrors) > 0 {
+		return &TypeError{d.typeErrors}
+	}
+	return nil
+}
+
+func (dec *Decoder) decode(v interface{}, present *FieldSet) error {
+	d := dec.newDecoder()
+	d.present = present
 	node, err := dec.parser.Parse()
 	if err != nil {
 		return err
@@ -141,6 +792,33 @@ func (dec *Decoder) Decode(v interface{}) (errOut error) {
 	return nil
 }
 
+// FieldSet is a set of dotted key paths recorded by Decoder.DecodeWithPresence.
+type FieldSet struct {
+	paths map[string]bool
+}
+
+// Has returns whether the key at the dotted path was present in the document.
+func (s *FieldSet) Has(path string) bool {
+	return s.paths[path]
+}
+
+// Paths returns the recorded paths in sorted order.
+func (s *FieldSet) Paths() []string {
+	paths := make([]string, 0, len(s.paths))
+	for p := range s.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *FieldSet) add(path []string) {
+	if s.paths == nil {
+		s.paths = make(map[string]bool)
+	}
+	s.paths[strings.Join(path, ".")] = true
+}
+
 func unmarshal(in []byte, out interface{}, strict bool) (errOut error) {
 	d := newDecoder()
 	p := NewParser(in)
@@ -195,6 +873,36 @@ func unmarshal(in []byte, out interface{}, strict bool) (errOut error) {
 //	             causing all of its fields or keys to be processed as if
 //	             they were part of the outer struct. For maps, keys must
 //	             not conflict with the yaml keys of other struct fields.
+//	             An interface{} field may be inlined in place of a map,
+//	             and receives the keys matching no other field as a
+//	             map[string]interface{}, or nil when there are none.
+//	             An InlineMap field receives them in document order.
+//	             As with maps, these keys are then not reported by
+//	             Decoder.KnownFields.
+//
+//	tag          Hold the tag of the mapping, such as "!shape", rather
+//	             than a key. The field must be a string. When marshalling,
+//	             a non-empty value is used as the tag of the mapping.
+//
+//	repeated     Collect the values of all the occurrences of the
+//	             key, which may be repeated in the mapping, into the
+//	             field, which must be a slice. When marshalling, the
+//	             key is written once for each element.
+//
+//	hex          Write the integer field in hexadecimal, such as 0xff.
+//	oct          Likewise, write it in octal, such as 0o17.
+//	bin          Likewise, write it in binary, such as 0b101.
+//
+//	validate=<name>
+//	             Call the validator registered with the given name,
+//	             see Decoder.RegisterValidator, once the field has been
+//	             unmarshalled, or once for each element of a repeated
+//	             field.
+//
+//	line         Receive the line of the value of the key when
+//	             unmarshalling, such as `yaml:"port,line"` next to the
+//	             field holding "port". The field must be an int and is
+//	             never marshalled.
 //
 // In addition, if the key is "-", the field is ignored.
 //
@@ -220,6 +928,74 @@ func Marshal(in interface{}) (out []byte, errOut error) {
 	return buf.Bytes(), nil
 }
 
+// QuoteString returns s as a YAML scalar that is read back as the same
+// string, for use when building YAML text by hand. s is written plain when
+// that is safe, and otherwise quoted as Marshal would. Strings holding line
+// breaks are double-quoted with escapes so the result is a single line.
+// Invalid UTF-8 is written as a !!binary scalar.
+func QuoteString(s string) string {
+	var v interface{} = s
+	if utf8.ValidString(s) && strings.ContainsAny(s, "\n\r\u0085\u2028\u2029") {
+		v = &Node{Kind: ScalarNode, Tag: resolve.StrTag, Value: s, Style: DoubleQuotedStyle}
+	}
+	out, err := Marshal(v)
+	if err != nil {
+		// Encoding a string into memory cannot fail.
+		panic(err)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// MarshalDiff serializes only the parts of modified that differ from base,
+// producing a minimal overlay document. Mappings, including those produced
+// from structs, are compared key by key and unchanged keys are omitted,
+// recursing into nested mappings. Any other value that changed, such as a
+// sequence, is written out in full. Keys present in base but missing from
+// modified cannot be represented in an overlay and are ignored. When nothing
+// differs the result is an empty mapping.
+func MarshalDiff(base, modified interface{}) ([]byte, error) {
+	var b, m Node
+	if err := b.Encode(base); err != nil {
+		return nil, err
+	}
+	if err := m.Encode(modified); err != nil {
+		return nil, err
+	}
+	diff := diffNode(&b, &m)
+	if diff == nil {
+		diff = &Node{Kind: MappingNode, Tag: resolve.MapTag}
+	}
+	return Marshal(diff)
+}
+
+// diffNode returns the parts of modified that differ from base, or nil if
+// the two hold the same content.
+func diffNode(base, modified *Node) *Node {
+	if base.Kind != MappingNode || modified.Kind != MappingNode || base.ShortTag() != modified.ShortTag() {
+		if base.ContentHash() == modified.ContentHash() && contentEqual(base, modified) {
+			return nil
+		}
+		return modified
+	}
+	baseKeys := indexMappingKeys(base)
+	diff := &Node{Kind: MappingNode, Tag: modified.Tag, Style: modified.Style}
+	for i := 0; i+1 < len(modified.Content); i += 2 {
+		key, value := modified.Content[i], modified.Content[i+1]
+		j := baseKeys.find(base, key)
+		if j < 0 {
+			diff.Content = append(diff.Content, key, value)
+			continue
+		}
+		if d := diffNode(base.Content[j+1], value); d != nil {
+			diff.Content = append(diff.Content, key, d)
+		}
+	}
+	if len(diff.Content) == 0 {
+		return nil
+	}
+	return diff
+}
+
 // Node represents an element in the YAML document hierarchy. While documents
 // are typically encoded and decoded into higher level types, such as structs
 // and maps, Node is an intermediate representation that allows detailed
@@ -287,10 +1063,29 @@ type Node struct {
 	// FootComment holds any comments following the node and before empty lines.
 	FootComment string
 
+	// BlankLinesBefore holds the number of empty lines between a key of a
+	// block mapping and the entry before it, including those around foot
+	// comments in between, but not the one after the head comment of the key
+	// that the trailing line break of the comment stands for. When encoding,
+	// they are written above the head comment of the key, which is then
+	// followed by that empty line, and ignored for other nodes and for the
+	// first key. When
+	// decoding, it is only set for the keys of the top-level mapping of a
+	// document, so groups of entries separated by empty lines survive a
+	// round trip. Empty lines following a folded scalar are not counted.
+	BlankLinesBefore int
+
 	// Line and Column hold the node position in the decoded YAML text.
 	// These fields are not respected when encoding the node.
 	Line   int
 	Column int
+
+	// extras holds the values attached with SetExtra.
+	extras *nodeExtras
+}
+
+type nodeExtras struct {
+	values map[interface{}]interface{}
 }
 
 // Decode decodes the node and stores its data into the value pointed to by v.
@@ -338,6 +1133,28 @@ func (n *Node) Encode(v interface{}) (errOut error) {
 	return nil
 }
 
+// A SyntaxError is returned when the input is not valid YAML, such as when
+// it cannot be scanned or parsed, or is not valid UTF-8. Its Kind tells
+// which of these failed. Line and Column start at 1, and are 0 when the
+// position is unknown. The message matches yaml.v3, which may report a
+// different line or none at all.
+type SyntaxError = yamlh.SyntaxError
+
+// SyntaxErrorKind is the stage of decoding that a SyntaxError comes from.
+type SyntaxErrorKind = yamlh.ErrorType
+
+const (
+	// ReaderError is the kind of SyntaxError for input that cannot be
+	// read, such as input that is not valid UTF-8.
+	ReaderError SyntaxErrorKind = yamlh.READER_ERROR
+	// ScannerError is the kind of SyntaxError for input that cannot be
+	// split into tokens.
+	ScannerError SyntaxErrorKind = yamlh.SCANNER_ERROR
+	// ParserError is the kind of SyntaxError for tokens that do not form
+	// a valid YAML document.
+	ParserError SyntaxErrorKind = yamlh.PARSER_ERROR
+)
+
 // A TypeError is returned by Unmarshal when one or more fields in
 // the YAML document cannot be properly decoded into the requested
 // types. When this error is returned, the value is still
@@ -374,7 +1191,157 @@ const (
 // IsZero returns whether the node has all of its fields unset.
 func (n *Node) IsZero() bool {
 	return n.Kind == 0 && n.Style == 0 && n.Tag == "" && n.Value == "" && n.Anchor == "" && n.Alias == nil && n.Content == nil &&
-		n.HeadComment == "" && n.LineComment == "" && n.FootComment == "" && n.Line == 0 && n.Column == 0
+		n.HeadComment == "" && n.LineComment == "" && n.FootComment == "" && n.BlankLinesBefore == 0 &&
+		n.Line == 0 && n.Column == 0
+}
+
+// Root returns the content of the document when n is a DocumentNode, or nil
+// when the document is empty. Other nodes are returned as they are, and a
+// nil n returns nil.
+func (n *Node) Root() *Node {
+	if n == nil || n.Kind != DocumentNode {
+		return n
+	}
+	if len(n.Content) == 0 {
+		return nil
+	}
+	return n.Content[0]
+}
+
+// Resolved returns the node n refers to when n is an alias, following
+// aliases to aliases, so tools walking a tree can treat aliases as the nodes
+// they refer to. Other nodes, aliases with no Alias set and a nil n are
+// returned as they are. Aliases that refer to themselves, as a tree built by
+// hand may have, return nil.
+func (n *Node) Resolved() *Node {
+	slow := n
+	for i := 0; n != nil && n.Kind == AliasNode && n.Alias != nil; i++ {
+		n = n.Alias
+		if i%2 == 1 {
+			slow = slow.Alias
+		}
+		if n == slow {
+			return nil
+		}
+	}
+	return n
+}
+
+// SetExtra attaches val to n under key, so tools processing the tree in
+// several passes can keep their own data with the nodes. Extras are ignored
+// when encoding and decoding. Setting a nil val removes key. As with
+// context.WithValue, key should be of an unexported type defined by the
+// tool to avoid collisions.
+//
+// Copies of a Node share its extras.
+func (n *Node) SetExtra(key, val interface{}) {
+	if val == nil {
+		if n.extras != nil {
+			delete(n.extras.values, key)
+		}
+		return
+	}
+	if n.extras == nil {
+		n.extras = &nodeExtras{values: make(map[interface{}]interface{})}
+	}
+	n.extras.values[key] = val
+}
+
+// Extra returns the value attached to n under key with SetExtra, or nil.
+func (n *Node) Extra(key interface{}) interface{} {
+	if n.extras == nil {
+		return nil
+	}
+	return n.extras.values[key]
+}
+
+// CanonicalTag returns the long form of tag, expanding the "!!" handle to
+// "tag:yaml.org,2002:" as the parser does, so "!!int" becomes
+// "tag:yaml.org,2002:int". Other tags, such as local "!custom" tags and tags
+// already in long form, are returned unchanged.
+func CanonicalTag(tag string) string {
+	return resolve.LongTag(tag)
+}
+
+// A VersionDirective is a %YAML directive, such as "%YAML 1.2".
+type VersionDirective = yamlh.VersionDirective
+
+// A TagDirective is a %TAG directive, such as "%TAG !e! tag:example.com,2000:".
+type TagDirective = yamlh.TagDirective
+
+// Directives returns the directives of the first document in data. It only
+// runs the parser up to the start of that document, so the document content
+// is neither decoded nor checked. version is nil when the document has no
+// %YAML directive, and tags is empty when it has no %TAG directives.
+func Directives(data []byte) (version *VersionDirective, tags []TagDirective, err error) {
+	parser := parserc.New(bytes.NewReader(data))
+	for {
+		event, err := parserc.Parse(parser)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch event.Type {
+		case yamlh.DOCUMENT_START_EVENT:
+			return event.Version_directive, event.Tag_directives, nil
+		case yamlh.STREAM_END_EVENT, yamlh.NO_EVENT:
+			return nil, nil, nil
+		}
+	}
+}
+
+// ValidateReader reads the YAML stream from r to its end and returns the
+// first syntax error found in it, with its line and column, or nil if the
+// stream is well-formed. It only runs the parser, one event at a time, so
+// unlike decoding it builds no nodes and uses memory bounded by the nesting
+// and the length of the longest scalar rather than by the size of the
+// stream. For the same reason, aliases are not checked against anchors.
+func ValidateReader(r io.Reader) error {
+	parser := parserc.New(r)
+	for {
+		event, err := parserc.Parse(parser)
+		if err != nil {
+			return err
+		}
+		if event.Type == yamlh.STREAM_END_EVENT || event.Type == yamlh.NO_EVENT {
+			return nil
+		}
+	}
+}
+
+// Complexity reports how large the YAML stream in data is without decoding
+// it, so a document can be rejected up front by its size. nodes is the
+// number of scalars, aliases, sequences and mappings in all the documents of
+// the stream, maxDepth the deepest nesting of sequences and mappings, with a
+// document made of a single scalar having a depth of 0, and aliases the
+// number of aliases. Aliases are counted once each, not expanded. It only
+// runs the parser, one event at a time, and returns the first syntax error
+// found along with the counts up to it.
+func Complexity(data []byte) (nodes int, maxDepth int, aliases int, err error) {
+	parser := parserc.New(bytes.NewReader(data))
+	depth := 0
+	for {
+		event, err := parserc.Parse(parser)
+		if err != nil {
+			return nodes, maxDepth, aliases, err
+		}
+		switch event.Type {
+		case yamlh.SCALAR_EVENT:
+			nodes++
+		case yamlh.ALIAS_EVENT:
+			nodes++
+			aliases++
+		case yamlh.SEQUENCE_START_EVENT, yamlh.MAPPING_START_EVENT:
+			nodes++
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case yamlh.SEQUENCE_END_EVENT, yamlh.MAPPING_END_EVENT:
+			depth--
+		case yamlh.STREAM_END_EVENT, yamlh.NO_EVENT:
+			return nodes, maxDepth, aliases, nil
+		}
+	}
 }
 
 // LongTag returns the long form of the tag that indicates the data type for
@@ -403,7 +1370,7 @@ func (n *Node) ShortTag() string {
 			}
 		case ScalarNode:
 			tag, _, err := resolve.Resolve("", n.Value)
-			if err == nil {
+			if err != nil {
 				panic(err)
 			}
 			return tag
@@ -440,6 +1407,399 @@ func (n *Node) SetString(s string) {
 	}
 }
 
+// SetHeadComment sets the comment lines written before the node. Lines that
+// do not already start with "#" are prefixed with "# ", and lines holding
+// newlines are split. Calling it with no lines removes the comment.
+func (n *Node) SetHeadComment(lines ...string) {
+	n.HeadComment = formatComment(lines)
+}
+
+// SetLineComment sets the comment written at the end of the node's line,
+// prefixed with "# " unless it already starts with "#". Newlines are replaced
+// with spaces.
+func (n *Node) SetLineComment(comment string) {
+	if comment == "" {
+		n.LineComment = ""
+		return
+	}
+	n.LineComment = formatComment([]string{strings.ReplaceAll(comment, "\n", " ")})
+}
+
+// SetFootComment sets the comment lines written after the node, formatted as
+// in SetHeadComment.
+func (n *Node) SetFootComment(lines ...string) {
+	n.FootComment = formatComment(lines)
+}
+
+func formatComment(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	for _, line := range strings.Split(strings.Join(lines, "\n"), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		switch {
+		case line == "":
+			buf.WriteByte('#')
+		case line[0] == '#':
+			buf.WriteString(line)
+		default:
+			buf.WriteString("# ")
+			buf.WriteString(line)
+		}
+	}
+	return buf.String()
+}
+
+// InsertAt inserts nodes into the sequence node n so that the first of them
+// ends up at position index. An index equal to len(n.Content) appends.
+func (n *Node) InsertAt(index int, nodes ...*Node) error {
+	if n.Kind != SequenceNode {
+		return fmt.Errorf("yaml: cannot insert sequence items into %s", n.kindString())
+	}
+	for _, node := range nodes {
+		if node == nil {
+			return errors.New("yaml: cannot insert a nil sequence item")
+		}
+	}
+	if index < 0 || index > len(n.Content) {
+		return fmt.Errorf("yaml: sequence index %d out of range [0, %d]", index, len(n.Content))
+	}
+	content := make([]*Node, 0, len(n.Content)+len(nodes))
+	content = append(content, n.Content[:index]...)
+	content = append(content, nodes...)
+	n.Content = append(content, n.Content[index:]...)
+	return nil
+}
+
+// InsertKeyAt inserts the key and value pair into the mapping node n so that
+// it becomes the pair at position index. Index counts pairs, not nodes, so an
+// index equal to len(n.Content)/2 appends.
+func (n *Node) InsertKeyAt(index int, key, value *Node) error {
+	if n.Kind != MappingNode {
+		return fmt.Errorf("yaml: cannot insert mapping keys into %s", n.kindString())
+	}
+	if key == nil || value == nil {
+		return errors.New("yaml: cannot insert a nil mapping key or value")
+	}
+	pairs := len(n.Content) / 2
+	if index < 0 || index > pairs {
+		return fmt.Errorf("yaml: mapping index %d out of range [0, %d]", index, pairs)
+	}
+	i := index * 2
+	n.Content = append(n.Content[:i], append([]*Node{key, value}, n.Content[i:]...)...)
+	return nil
+}
+
+// UnusedAnchors returns the anchors in the tree rooted at n that are not
+// referenced by any alias node in it, in document order. An anchor that is
+// redefined is reported for each of its nodes that is not referenced.
+func (n *Node) UnusedAnchors() []string {
+	var anchored []*Node
+	used := make(map[*Node]bool)
+	usedNames := make(map[string]bool)
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n == nil {
+			return
+		}
+		if n.Kind == AliasNode {
+			if n.Alias != nil {
+				used[n.Alias] = true
+			} else {
+				usedNames[n.Value] = true
+			}
+			return
+		}
+		if n.Anchor != "" {
+			anchored = append(anchored, n)
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(n)
+	var unused []string
+	for _, a := range anchored {
+		if !used[a] && !usedNames[a.Anchor] {
+			unused = append(unused, a.Anchor)
+		}
+	}
+	return unused
+}
+
+// ContentHash returns a hash of the content of the tree rooted at n, which
+// ignores its formatting: styles, comments, positions, anchors and the order
+// of mapping keys. Scalars are hashed by their resolved tag and value, so
+// "0x10" and 16 hash equal, and aliases are hashed as the node they refer to.
+// A document hashes as its content.
+func (n *Node) ContentHash() uint64 {
+	return contentHash(n, make(map[*Node]bool))
+}
+
+func contentHash(n *Node, visiting map[*Node]bool) uint64 {
+	h := fnv.New64a()
+	if n == nil {
+		return h.Sum64()
+	}
+	if visiting[n] {
+		// An alias to an enclosing node.
+		h.Write([]byte{'*'})
+		return h.Sum64()
+	}
+	visiting[n] = true
+	defer delete(visiting, n)
+
+	var buf [8]byte
+	writeHash := func(sum uint64) {
+		binary.BigEndian.PutUint64(buf[:], sum)
+		h.Write(buf[:])
+	}
+	switch n.Kind {
+	case DocumentNode:
+		return contentHash(n.Root(), visiting)
+	case AliasNode:
+		if n.Alias != nil {
+			return contentHash(n.Alias, visiting)
+		}
+		h.Write([]byte{'*'})
+		h.Write([]byte(n.Value))
+	case ScalarNode:
+		h.Write([]byte{'='})
+		h.Write([]byte(scalarContent(n)))
+	case SequenceNode:
+		h.Write([]byte{'['})
+		h.Write([]byte(n.ShortTag()))
+		for _, c := range n.Content {
+			writeHash(contentHash(c, visiting))
+		}
+	case MappingNode:
+		h.Write([]byte{'{'})
+		h.Write([]byte(n.ShortTag()))
+		pairs := make([]uint64, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pair := fnv.New64a()
+			binary.BigEndian.PutUint64(buf[:], contentHash(n.Content[i], visiting))
+			pair.Write(buf[:])
+			binary.BigEndian.PutUint64(buf[:], contentHash(n.Content[i+1], visiting))
+			pair.Write(buf[:])
+			pairs = append(pairs, pair.Sum64())
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i] < pairs[j] })
+		for _, sum := range pairs {
+			writeHash(sum)
+		}
+	}
+	return h.Sum64()
+}
+
+// contentEqual reports whether a and b hold the same content, ignoring the
+// same formatting that ContentHash ignores.
+func contentEqual(a, b *Node) bool {
+	return contentEqualVisiting(a, b, make(map[[2]*Node]bool))
+}
+
+func contentEqualVisiting(a, b *Node, visiting map[[2]*Node]bool) bool {
+	if a != nil && a.Kind == DocumentNode {
+		a = a.Root()
+	}
+	if b != nil && b.Kind == DocumentNode {
+		b = b.Root()
+	}
+	for a != nil && a.Kind == AliasNode && a.Alias != nil {
+		a = a.Alias
+	}
+	for b != nil && b.Kind == AliasNode && b.Alias != nil {
+		b = b.Alias
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a == b {
+		return true
+	}
+	pair := [2]*Node{a, b}
+	if visiting[pair] {
+		// Comparing a node with itself through aliases to enclosing nodes.
+		return true
+	}
+	visiting[pair] = true
+	defer delete(visiting, pair)
+
+	if a.Kind != b.Kind {
+		return false
+	}
+	switch a.Kind {
+	case AliasNode:
+		return a.Value == b.Value
+	case ScalarNode:
+		return scalarContent(a) == scalarContent(b)
+	case SequenceNode:
+		if a.ShortTag() != b.ShortTag() || len(a.Content) != len(b.Content) {
+			return false
+		}
+		for i := range a.Content {
+			if !contentEqualVisiting(a.Content[i], b.Content[i], visiting) {
+				return false
+			}
+		}
+		return true
+	case MappingNode:
+		if a.ShortTag() != b.ShortTag() || len(a.Content) != len(b.Content) {
+			return false
+		}
+		// Match every pair of a to a distinct pair of b, ignoring the order
+		// of keys. Key hashes narrow down the candidates.
+		bKeys := make(map[uint64][]int, len(b.Content)/2)
+		for j := 0; j+1 < len(b.Content); j += 2 {
+			h := b.Content[j].ContentHash()
+			bKeys[h] = append(bKeys[h], j)
+		}
+		matched := make([]bool, len(b.Content)/2)
+	pairs:
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			for _, j := range bKeys[a.Content[i].ContentHash()] {
+				if matched[j/2] {
+					continue
+				}
+				if contentEqualVisiting(a.Content[i], b.Content[j], visiting) &&
+					contentEqualVisiting(a.Content[i+1], b.Content[j+1], visiting) {
+					matched[j/2] = true
+					continue pairs
+				}
+			}
+			return false
+		}
+		return true
+	}
+	return true
+}
+
+// mappingKeys indexes the keys of a mapping by their ContentHash.
+type mappingKeys map[uint64][]int
+
+// indexMappingKeys returns the index of the keys of mapping n.
+func indexMappingKeys(n *Node) mappingKeys {
+	keys := make(mappingKeys, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		keys.add(n.Content[i], i)
+	}
+	return keys
+}
+
+// add records that key is at index i in the content of the mapping.
+func (k mappingKeys) add(key *Node, i int) {
+	h := key.ContentHash()
+	k[h] = append(k[h], i)
+}
+
+// find returns the index in the content of mapping n, indexed by k, of the
+// first key with the same content as key, or -1 if there is none.
+func (k mappingKeys) find(n, key *Node) int {
+	for _, i := range k[key.ContentHash()] {
+		if contentEqual(n.Content[i], key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// scalarContent returns the resolved tag and value of scalar n in the form
+// that ContentHash hashes.
+func scalarContent(n *Node) string {
+	tag := n.ShortTag()
+	rtag, value, err := resolve.Resolve(tag, n.Value)
+	if err != nil {
+		rtag, value = tag, n.Value
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC()
+	}
+	return fmt.Sprintf("%s\x00%v", rtag, value)
+}
+
+func (n *Node) kindString() string {
+	switch n.Kind {
+	case DocumentNode:
+		return "document node"
+	case SequenceNode:
+		return "sequence node"
+	case MappingNode:
+		return "mapping node"
+	case ScalarNode:
+		return "scalar node"
+	case AliasNode:
+		return "alias node"
+	}
+	return fmt.Sprintf("node with unknown kind %d", n.Kind)
+}
+
+// --------------------------------------------------------------------------
+// Registry of string enum types validated on decode.
+
+type enumInfo struct {
+	valid map[string]bool
+	names []string
+}
+
+var (
+	enumMap   = make(map[reflect.Type]*enumInfo)
+	enumMutex sync.RWMutex
+)
+
+// RegisterEnum registers the values a string type T may hold. Decoding a
+// scalar into a T, or into a map key of type T, fails with a *TypeError
+// listing the valid values unless the scalar matches one of them exactly.
+// Matching is case-sensitive.
+//
+// Calling RegisterEnum again for the same type replaces its values.
+func RegisterEnum[T ~string](valid ...T) {
+	info := &enumInfo{
+		valid: make(map[string]bool, len(valid)),
+		names: make([]string, 0, len(valid)),
+	}
+	for _, v := range valid {
+		if info.valid[string(v)] {
+			continue
+		}
+		info.valid[string(v)] = true
+		info.names = append(info.names, strconv.Quote(string(v)))
+	}
+	enumMutex.Lock()
+	enumMap[reflect.TypeOf((*T)(nil)).Elem()] = info
+	enumMutex.Unlock()
+}
+
+func getEnumInfo(t reflect.Type) *enumInfo {
+	enumMutex.RLock()
+	info := enumMap[t]
+	enumMutex.RUnlock()
+	return info
+}
+
+// InlineItem is a key and its value in an InlineMap.
+type InlineItem struct {
+	Key   string
+	Value interface{}
+
+	// after is the key of the struct field the item followed when it was
+	// unmarshalled, or "" when it came first. placed tells whether the
+	// item was unmarshalled along with the struct at all.
+	after  string
+	placed bool
+}
+
+// InlineMap may be used as the type of an ,inline field in place of a map.
+// It receives the keys matching no other field of the struct, with their
+// values unmarshalled as for an interface{}, in the order they appear, and
+// records where they appeared among the struct fields. When marshalling,
+// its items follow the struct fields in order, or go back to where they
+// appeared with Encoder.SetPreserveInlineOrder.
+type InlineMap []InlineItem
+
 // --------------------------------------------------------------------------
 // Maintain a mapping of keys to structure field indexes
 
@@ -452,12 +1812,35 @@ type structInfo struct {
 	FieldsList []fieldInfo
 
 	// InlineMap is the number of the field in the struct that
-	// contains an ,inline map, or -1 if there's none.
+	// contains an ,inline map or interface{}, or -1 if there's none.
 	InlineMap int
 
 	// InlineUnmarshalers holds indexes to inlined fields that
 	// contain unmarshaler values.
 	InlineUnmarshalers [][]int
+
+	// TagField is the number of the field in the struct that
+	// holds the ,tag of the mapping, or -1 if there's none.
+	TagField int
+
+	// LineFields holds the indexes of the ,line fields in the struct,
+	// by the key whose value line they receive.
+	LineFields map[string][]int
+
+	// PromotedPtrs holds the numbers of the untagged embedded struct
+	// pointer fields, whose fields decoders may promote.
+	PromotedPtrs []int
+}
+
+// foldedKey returns the key of the first field whose key is equal to key
+// under Unicode case folding.
+func (sinfo *structInfo) foldedKey(key string) (string, bool) {
+	for _, info := range sinfo.FieldsList {
+		if strings.EqualFold(info.Key, key) {
+			return info.Key, true
+		}
+	}
+	return "", false
 }
 
 type fieldInfo struct {
@@ -465,6 +1848,13 @@ type fieldInfo struct {
 	Num       int
 	OmitEmpty bool
 	Flow      bool
+	Repeated  bool
+	// Validator holds the name of the validator set with the validate
+	// option, or "" if there's none.
+	Validator string
+	// Base holds the base integers are written in, set by the ,hex, ,oct
+	// and ,bin flags, or 0 for decimal.
+	Base int
 	// Id holds the unique field identifier, so we can cheaply
 	// check for field duplicates without maintaining an extra map.
 	Id int
@@ -474,9 +1864,14 @@ type fieldInfo struct {
 }
 
 var (
-	structMap       = make(map[reflect.Type]*structInfo)
-	fieldMapMutex   sync.RWMutex
-	unmarshalerType reflect.Type
+	structMap           = make(map[reflect.Type]*structInfo)
+	promotedMap         = make(map[reflect.Type]map[string]fieldInfo)
+	fieldMapMutex       sync.RWMutex
+	unmarshalerType     reflect.Type
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	inlineMapType       = reflect.TypeOf(InlineMap(nil))
 )
 
 func init() {
@@ -484,6 +1879,26 @@ func init() {
 	unmarshalerType = reflect.ValueOf(&v).Elem().Type()
 }
 
+// isPromotedPtr returns whether field is an untagged embedded pointer to a
+// struct whose fields may be promoted into the outer struct when decoding,
+// as done by encoding/json. Types with custom (un)marshalling are never
+// promoted.
+func isPromotedPtr(field reflect.StructField, st reflect.Type) bool {
+	if !field.Anonymous || field.PkgPath != "" || field.Type.Kind() != reflect.Ptr {
+		return false
+	}
+	elem := field.Type.Elem()
+	if elem.Kind() != reflect.Struct || elem == st || elem == nodeType {
+		return false
+	}
+	for _, iface := range []reflect.Type{unmarshalerType, marshalerType, textUnmarshalerType, textMarshalerType} {
+		if field.Type.Implements(iface) {
+			return false
+		}
+	}
+	return true
+}
+
 func getStructInfo(st reflect.Type) (*structInfo, error) {
 	fieldMapMutex.RLock()
 	sinfo, found := structMap[st]
@@ -496,7 +1911,10 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 	fieldsMap := make(map[string]fieldInfo)
 	fieldsList := make([]fieldInfo, 0, n)
 	inlineMap := -1
+	tagField := -1
+	lineFields := map[string][]int(nil)
 	inlineUnmarshalers := [][]int(nil)
+	promotedPtrs := []int(nil)
 	for i := 0; i != n; i++ {
 		field := st.Field(i)
 		if field.PkgPath != "" && !field.Anonymous {
@@ -514,9 +1932,15 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 		}
 
 		inline := false
+		tagOnly := false
+		lineOnly := false
 		fields := strings.Split(tag, ",")
 		if len(fields) > 1 {
 			for _, flag := range fields[1:] {
+				if name := strings.TrimPrefix(flag, "validate="); name != flag && name != "" {
+					info.Validator = name
+					continue
+				}
 				switch flag {
 				case "omitempty":
 					info.OmitEmpty = true
@@ -524,6 +1948,30 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 					info.Flow = true
 				case "inline":
 					inline = true
+				case "tag":
+					tagOnly = true
+				case "line":
+					lineOnly = true
+				case "hex", "oct", "bin":
+					ftype := field.Type
+					for ftype.Kind() == reflect.Ptr {
+						ftype = ftype.Elem()
+					}
+					switch ftype.Kind() {
+					case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+					default:
+						return nil, errors.New("option ," + flag + " needs an integer field in struct " + st.String())
+					}
+					if info.Base != 0 {
+						return nil, fmt.Errorf("conflicting flags in tag %q of type %s", tag, st)
+					}
+					info.Base = map[string]int{"hex": 16, "oct": 8, "bin": 2}[flag]
+				case "repeated":
+					if field.Type.Kind() != reflect.Slice {
+						return nil, errors.New("option ,repeated needs a slice field in struct " + st.String())
+					}
+					info.Repeated = true
 				default:
 					return nil, fmt.Errorf("unsupported flag %q in tag %q of type %s", flag, tag, st)
 				}
@@ -531,6 +1979,39 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 			tag = fields[0]
 		}
 
+		promote := tag == "" && len(fields) == 1 && isPromotedPtr(field, st)
+
+		if tagOnly {
+			if tagField >= 0 {
+				return nil, errors.New("multiple ,tag fields in struct " + st.String())
+			}
+			if field.Type.Kind() != reflect.String {
+				return nil, errors.New("option ,tag needs a string field in struct " + st.String())
+			}
+			tagField = i
+			continue
+		}
+
+		if lineOnly {
+			key := tag
+			if key == "" {
+				key = strings.ToLower(field.Name)
+			}
+			if _, found = lineFields[key]; found {
+				return nil, errors.New("multiple ,line fields for key '" + key + "' in struct " + st.String())
+			}
+			switch field.Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			default:
+				return nil, errors.New("option ,line needs an int field in struct " + st.String())
+			}
+			if lineFields == nil {
+				lineFields = make(map[string][]int)
+			}
+			lineFields[key] = []int{i}
+			continue
+		}
+
 		if inline {
 			switch field.Type.Kind() {
 			case reflect.Map:
@@ -541,6 +2022,22 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 					return nil, errors.New("option ,inline needs a map with string keys in struct " + st.String())
 				}
 				inlineMap = info.Num
+			case reflect.Interface:
+				if inlineMap >= 0 {
+					return nil, errors.New("multiple ,inline maps in struct " + st.String())
+				}
+				if field.Type.NumMethod() != 0 {
+					return nil, errors.New("option ,inline needs an empty interface in struct " + st.String())
+				}
+				inlineMap = info.Num
+			case reflect.Slice:
+				if field.Type != inlineMapType {
+					return nil, errors.New("option ,inline may only be used on a struct or map field")
+				}
+				if inlineMap >= 0 {
+					return nil, errors.New("multiple ,inline maps in struct " + st.String())
+				}
+				inlineMap = info.Num
 			case reflect.Struct, reflect.Ptr:
 				ftype := field.Type
 				for ftype.Kind() == reflect.Ptr {
@@ -560,6 +2057,15 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 					for _, index := range sinfo.InlineUnmarshalers {
 						inlineUnmarshalers = append(inlineUnmarshalers, append([]int{i}, index...))
 					}
+					for key, index := range sinfo.LineFields {
+						if _, found = lineFields[key]; found {
+							return nil, errors.New("multiple ,line fields for key '" + key + "' in struct " + st.String())
+						}
+						if lineFields == nil {
+							lineFields = make(map[string][]int)
+						}
+						lineFields[key] = append([]int{i}, index...)
+					}
 					for _, finfo := range sinfo.FieldsList {
 						_, ok := fieldsMap[finfo.Key]
 						if ok {
@@ -596,6 +2102,10 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 		info.Id = len(fieldsList)
 		fieldsList = append(fieldsList, info)
 		fieldsMap[info.Key] = info
+
+		if promote {
+			promotedPtrs = append(promotedPtrs, i)
+		}
 	}
 
 	sinfo = &structInfo{
@@ -603,6 +2113,9 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 		FieldsList:         fieldsList,
 		InlineMap:          inlineMap,
 		InlineUnmarshalers: inlineUnmarshalers,
+		TagField:           tagField,
+		LineFields:         lineFields,
+		PromotedPtrs:       promotedPtrs,
 	}
 
 	fieldMapMutex.Lock()
@@ -611,6 +2124,79 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 	return sinfo, nil
 }
 
+// getPromotedFields returns the fields promoted into st from its untagged
+// embedded struct pointers by key, for decoders that promote them. Their Id
+// follows the ones of FieldsList, in struct field order. They are only
+// computed once needed, as the embedded types may refer back to st.
+func getPromotedFields(st reflect.Type, sinfo *structInfo) (map[string]fieldInfo, error) {
+	fieldMapMutex.RLock()
+	promoted, found := promotedMap[st]
+	fieldMapMutex.RUnlock()
+	if found {
+		return promoted, nil
+	}
+
+	fields, err := promotedFields(st, sinfo, map[reflect.Type]bool{st: true})
+	if err != nil {
+		return nil, err
+	}
+	promoted = make(map[string]fieldInfo, len(fields))
+	for i, info := range fields {
+		info.Id = len(sinfo.FieldsList) + i
+		promoted[info.Key] = info
+	}
+
+	fieldMapMutex.Lock()
+	promotedMap[st] = promoted
+	fieldMapMutex.Unlock()
+	return promoted, nil
+}
+
+// promotedFields returns the fields promoted into st in struct field order,
+// leaving out the keys of the fields of st and the keys promoted from more
+// than one field. visited holds the types being promoted from, so types
+// embedding each other are not walked again.
+func promotedFields(st reflect.Type, sinfo *structInfo, visited map[reflect.Type]bool) ([]fieldInfo, error) {
+	var fields []fieldInfo
+	count := make(map[string]int)
+	for _, num := range sinfo.PromotedPtrs {
+		pt := st.Field(num).Type.Elem()
+		if visited[pt] {
+			continue
+		}
+		psinfo, err := getStructInfo(pt)
+		if err != nil {
+			return nil, err
+		}
+		visited[pt] = true
+		nested, err := promotedFields(pt, psinfo, visited)
+		delete(visited, pt)
+		if err != nil {
+			return nil, err
+		}
+		for _, list := range [][]fieldInfo{psinfo.FieldsList, nested} {
+			for _, info := range list {
+				if info.Inline == nil {
+					info.Inline = []int{num, info.Num}
+				} else {
+					info.Inline = append([]int{num}, info.Inline...)
+				}
+				fields = append(fields, info)
+				count[info.Key]++
+			}
+		}
+	}
+
+	promoted := fields[:0]
+	for _, info := range fields {
+		if _, found := sinfo.FieldsMap[info.Key]; found || count[info.Key] > 1 {
+			continue
+		}
+		promoted = append(promoted, info)
+	}
+	return promoted, nil
+}
+
 // IsZeroer is used to check whether an object is zero to
 // determine whether it should be omitted when marshaling
 // with the omitempty flag. One notable implementation